@@ -6,10 +6,14 @@ Package adapt provides domain logic adaptors shaped to [oakmux.Handler]. Adaptor
 3. VoidFunc: func(context, inputStruct) error
 
 Each input requires implementation of [Validatable] for safety. Validation errors are decorated with the correct [http.StatusUnprocessableEntity] status code.
+
+Outputs that implement [Tagged] or [Dated] emit ETag and Last-Modified validators. Safe requests with fresh If-None-Match or If-Modified-Since preconditions are answered with [http.StatusNotModified] without encoding the output.
 */
 package adapt
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 )
 
@@ -38,3 +42,18 @@ func (e *InvalidRequestError) Unwrap() error {
 func (e *InvalidRequestError) HyperTextStatusCode() int {
 	return http.StatusUnprocessableEntity
 }
+
+// newDecodingError wraps decoder errors as [InvalidRequestError] unless they already carry a status code or come from a [Loader].
+func newDecodingError(err error) error {
+	var loader *loaderError
+	if errors.As(err, &loader) {
+		return loader.error
+	}
+	var httpError interface {
+		HyperTextStatusCode() int
+	}
+	if errors.As(err, &httpError) {
+		return err
+	}
+	return NewInvalidRequestError(fmt.Errorf("unable to decode: %w", err))
+}
@@ -0,0 +1,153 @@
+package adapt
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// CoalescingKeyFunc derives the key that identifies identical requests. Returning an empty string exempts the request from coalescing.
+type CoalescingKeyFunc func(*http.Request) (string, error)
+
+// DefaultCoalescingKey treats requests with the same method and URI as identical. Requests with Authorization or Cookie headers are exempt, because the result may depend on who is asking. Provide a key function that includes the principal to coalesce them.
+func DefaultCoalescingKey(r *http.Request) (string, error) {
+	if hasCredentials(r) {
+		return "", nil
+	}
+	return r.Method + " " + r.URL.RequestURI(), nil
+}
+
+// hasCredentials reports whether the request identifies its sender to the domain call.
+func hasCredentials(r *http.Request) bool {
+	return r.Header.Get("Authorization") != "" || r.Header.Get("Cookie") != ""
+}
+
+type coalescedCall[O any] struct {
+	done    chan struct{}
+	value   O
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// coalescer shares a single domain call between concurrent requests with the same key. The call runs on a context detached from the request that started it, so that its cancellation does not fail the other requests, but it keeps the values and the deadline of that context. Every waiter receives the result computed with the values of the first request, such as its principal. The call is cancelled when its deadline passes or when every waiting request gives up.
+type coalescer[O any] struct {
+	mu    sync.Mutex
+	calls map[string]*coalescedCall[O]
+}
+
+func newCoalescer[O any]() *coalescer[O] {
+	return &coalescer[O]{calls: make(map[string]*coalescedCall[O])}
+}
+
+func (c *coalescer[O]) Do(
+	ctx context.Context,
+	key string,
+	call func(context.Context) (O, error),
+) (O, error) {
+	c.mu.Lock()
+	shared, ok := c.calls[key]
+	if !ok {
+		callContext, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		if deadline, ok := ctx.Deadline(); ok {
+			callContext, cancel = context.WithDeadline(context.WithoutCancel(ctx), deadline)
+		}
+		shared = &coalescedCall[O]{
+			done:   make(chan struct{}),
+			cancel: cancel,
+		}
+		c.calls[key] = shared
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					shared.err = fmt.Errorf("coalesced domain call panicked: %v", p)
+				}
+				cancel()
+				c.mu.Lock()
+				if c.calls[key] == shared {
+					delete(c.calls, key)
+				}
+				c.mu.Unlock()
+				close(shared.done)
+			}()
+			shared.value, shared.err = call(callContext)
+		}()
+	}
+	shared.waiters++
+	c.mu.Unlock()
+
+	select {
+	case <-shared.done:
+		return shared.value, shared.err
+	case <-ctx.Done():
+		c.mu.Lock()
+		shared.waiters--
+		if shared.waiters == 0 {
+			shared.cancel()
+			if c.calls[key] == shared {
+				delete(c.calls, key)
+			}
+		}
+		c.mu.Unlock()
+		var zero O
+		return zero, ctx.Err()
+	}
+}
+
+// NewCoalescingNullaryFuncAdaptor creates a [NullaryFuncAdaptor] that shares one domain call result between concurrent requests with the same key. The shared output is encoded once per request, so it must not be mutated by the encoder. The domain call runs with the context values of the first request. A <nil> key function defaults to [DefaultCoalescingKey].
+func NewCoalescingNullaryFuncAdaptor[O any](
+	domainCall func(context.Context) (O, error),
+	encoder Encoder[O],
+	key CoalescingKeyFunc,
+) (*NullaryFuncAdaptor[O], error) {
+	adaptor, err := NewNullaryFuncAdaptor(domainCall, encoder)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		key = DefaultCoalescingKey
+	}
+	adaptor.coalescer = newCoalescer[O]()
+	adaptor.key = key
+	return adaptor, nil
+}
+
+// NewCoalescingStringUnaryFuncAdaptor creates a [StringUnaryFuncAdaptor] that shares one domain call result between concurrent requests with the same extracted string. The domain call runs with the context values of the first request, so requests with Authorization or Cookie headers are not coalesced.
+func NewCoalescingStringUnaryFuncAdaptor[O any](
+	domainCall func(context.Context, string) (O, error),
+	extractor func(*http.Request) (string, error),
+	encoder Encoder[O],
+) (*StringUnaryFuncAdaptor[O], error) {
+	adaptor, err := NewStringUnaryFuncAdaptor(domainCall, extractor, encoder)
+	if err != nil {
+		return nil, err
+	}
+	adaptor.coalescer = newCoalescer[O]()
+	return adaptor, nil
+}
+
+func (a *NullaryFuncAdaptor[O]) call(r *http.Request) (O, error) {
+	if a.coalescer == nil {
+		return a.domainCall(r.Context())
+	}
+	key, err := a.key(r)
+	if err != nil {
+		var zero O
+		return zero, fmt.Errorf("unable to derive coalescing key: %w", err)
+	}
+	if key == "" {
+		return a.domainCall(r.Context())
+	}
+	return a.coalescer.Do(r.Context(), key, a.domainCall)
+}
+
+func (a *StringUnaryFuncAdaptor[O]) call(r *http.Request, request string) (O, error) {
+	ctx := r.Context()
+	if a.coalescer == nil || hasCredentials(r) {
+		return a.domainCall(ctx, request)
+	}
+	return a.coalescer.Do(ctx, request, func(ctx context.Context) (O, error) {
+		return a.domainCall(ctx, request)
+	})
+}
@@ -0,0 +1,151 @@
+package adapt
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCoalescingNullaryFuncAdaptor(t *testing.T) {
+	calls := atomic.Int32{}
+	release := make(chan struct{})
+	adaptor, err := NewCoalescingNullaryFuncAdaptor(
+		func(ctx context.Context) (int32, error) {
+			<-release
+			return calls.Add(1), ctx.Err()
+		},
+		NewJSONEncoder[int32](),
+		nil,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaderContext, cancelLeader := context.WithCancel(context.Background())
+	leaderDone := make(chan error)
+	go func() {
+		r := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(leaderContext)
+		leaderDone <- adaptor.ServeHyperText(httptest.NewRecorder(), r)
+	}()
+	for {
+		adaptor.coalescer.mu.Lock()
+		started := len(adaptor.coalescer.calls) == 1
+		adaptor.coalescer.mu.Unlock()
+		if started {
+			break
+		}
+	}
+
+	const followers = 8
+	wg := sync.WaitGroup{}
+	bodies := make([]string, followers)
+	errs := make([]error, followers)
+	for i := 0; i < followers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			errs[i] = adaptor.ServeHyperText(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			bodies[i] = w.Body.String()
+		}(i)
+	}
+	for {
+		adaptor.coalescer.mu.Lock()
+		waiters := adaptor.coalescer.calls["GET /"].waiters
+		adaptor.coalescer.mu.Unlock()
+		if waiters == followers+1 {
+			break
+		}
+	}
+
+	cancelLeader()
+	if err = <-leaderDone; err != context.Canceled {
+		t.Fatal("leader was not cancelled:", err)
+	}
+	close(release)
+	wg.Wait()
+
+	for i := 0; i < followers; i++ {
+		if errs[i] != nil {
+			t.Fatal("follower failed after leader cancellation:", errs[i])
+		}
+		if bodies[i] != "1\n" {
+			t.Fatalf("follower did not share the result: %q", bodies[i])
+		}
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("domain call was performed %d times", calls.Load())
+	}
+}
+
+type principalKey struct{}
+
+func TestCoalescingSeparatesPrincipals(t *testing.T) {
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	adaptor, err := NewCoalescingNullaryFuncAdaptor(
+		func(ctx context.Context) (string, error) {
+			started <- struct{}{}
+			<-release
+			return "secret of " + ctx.Value(principalKey{}).(string), nil
+		},
+		NewJSONEncoder[string](),
+		nil,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	principals := []string{"Bearer alice", "Bearer bob"}
+	bodies := make([]string, len(principals))
+	wg := sync.WaitGroup{}
+	for i, principal := range principals {
+		wg.Add(1)
+		go func(i int, principal string) {
+			defer wg.Done()
+			r := httptest.NewRequest(http.MethodGet, "/profile", nil)
+			r.Header.Set("Authorization", principal)
+			r = r.WithContext(context.WithValue(r.Context(), principalKey{}, principal))
+			w := httptest.NewRecorder()
+			if err := adaptor.ServeHyperText(w, r); err != nil {
+				t.Error(err)
+			}
+			bodies[i] = w.Body.String()
+		}(i, principal)
+	}
+	for range principals {
+		select {
+		case <-started:
+		case <-time.After(time.Second * 5):
+			t.Fatal("requests of different principals were coalesced")
+		}
+	}
+	close(release)
+	wg.Wait()
+	for i, principal := range principals {
+		if expected := `"secret of ` + principal + `"` + "\n"; bodies[i] != expected {
+			t.Fatalf("%s received %q instead of %q", principal, bodies[i], expected)
+		}
+	}
+}
+
+func TestCoalescedCallKeepsDeadline(t *testing.T) {
+	c := newCoalescer[bool]()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	expected, _ := ctx.Deadline()
+	hasDeadline, err := c.Do(ctx, "key", func(ctx context.Context) (bool, error) {
+		deadline, ok := ctx.Deadline()
+		return ok && deadline.Equal(expected), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasDeadline {
+		t.Fatal("coalesced call lost the deadline of the request")
+	}
+}
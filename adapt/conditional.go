@@ -0,0 +1,173 @@
+package adapt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Tagged outputs provide an entity tag validator. Unquoted tags are quoted as strong tags.
+type Tagged interface {
+	ETag() string
+}
+
+// Dated outputs provide a modification time validator.
+type Dated interface {
+	LastModified() time.Time
+}
+
+// ConditionalEncoder is an [Encoder] that consults request preconditions before writing the body.
+type ConditionalEncoder[O any] interface {
+	Encoder[O]
+	EncodeConditionally(http.ResponseWriter, *http.Request, O) error
+}
+
+func quoteETag(tag string) string {
+	if strings.HasPrefix(tag, `"`) || strings.HasPrefix(tag, `W/"`) {
+		return tag
+	}
+	return `"` + tag + `"`
+}
+
+// matchETag performs weak comparison of the tag against a list of entity tags from If-None-Match or If-Match header.
+func matchETag(list, tag string) bool {
+	tag = strings.TrimPrefix(tag, "W/")
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// writeValidators sets ETag and Last-Modified headers from the output and reports the validators found.
+func writeValidators(w http.ResponseWriter, output any) (tag string, modified time.Time) {
+	if tagged, ok := output.(Tagged); ok {
+		if tag = tagged.ETag(); tag != "" {
+			tag = quoteETag(tag)
+			w.Header().Set("ETag", tag)
+		}
+	}
+	if dated, ok := output.(Dated); ok {
+		if modified = dated.LastModified(); !modified.IsZero() {
+			modified = modified.UTC().Truncate(time.Second)
+			w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+		}
+	}
+	return tag, modified
+}
+
+// isNotModified evaluates If-None-Match and If-Modified-Since preconditions for safe requests.
+func isNotModified(r *http.Request, tag string, modified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		return tag != "" && matchETag(match, tag)
+	}
+	if modified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	return !modified.After(since)
+}
+
+// encode writes the validators of the output and answers with [http.StatusNotModified], when the client copy is fresh. Otherwise, the output is encoded.
+func encode[O any](
+	w http.ResponseWriter,
+	r *http.Request,
+	encoder Encoder[O],
+	output O,
+) error {
+	tag, modified := writeValidators(w, output)
+	if isNotModified(r, tag, modified) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	if conditional, ok := encoder.(ConditionalEncoder[O]); ok {
+		return conditional.EncodeConditionally(w, r, output)
+	}
+	return encoder.Encode(w, output)
+}
+
+type hashingEncoder[O any] struct {
+	encoder Encoder[O]
+}
+
+// NewHashingEncoder wraps an [Encoder] to derive a strong ETag from the hash of the encoded body. Since the body must be encoded to be hashed, the encoding is buffered and only the transmission is skipped for fresh client copies.
+func NewHashingEncoder[O any](encoder Encoder[O]) ConditionalEncoder[O] {
+	var zero Encoder[O]
+	if encoder == zero {
+		panic("cannot use a <nil> encoder")
+	}
+	return hashingEncoder[O]{encoder: encoder}
+}
+
+func (h hashingEncoder[O]) encode(w http.ResponseWriter, value O) (*bufferedWriter, string, error) {
+	buffer := &bufferedWriter{header: w.Header()}
+	if err := h.encoder.Encode(buffer, value); err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(buffer.body.Bytes())
+	tag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	if w.Header().Get("ETag") == "" {
+		w.Header().Set("ETag", tag)
+	}
+	return buffer, tag, nil
+}
+
+func (h hashingEncoder[O]) Encode(w http.ResponseWriter, value O) error {
+	buffer, _, err := h.encode(w, value)
+	if err != nil {
+		return err
+	}
+	return buffer.WriteTo(w)
+}
+
+func (h hashingEncoder[O]) EncodeConditionally(w http.ResponseWriter, r *http.Request, value O) error {
+	buffer, tag, err := h.encode(w, value)
+	if err != nil {
+		return err
+	}
+	if isNotModified(r, tag, time.Time{}) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	return buffer.WriteTo(w)
+}
+
+// bufferedWriter collects the body and status code while sharing the header map with the underlying [http.ResponseWriter].
+type bufferedWriter struct {
+	header     http.Header
+	body       bytes.Buffer
+	statusCode int
+}
+
+func (b *bufferedWriter) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedWriter) WriteHeader(statusCode int) {
+	if b.statusCode == 0 {
+		b.statusCode = statusCode
+	}
+}
+
+func (b *bufferedWriter) Write(p []byte) (int, error) {
+	return b.body.Write(p)
+}
+
+func (b *bufferedWriter) WriteTo(w http.ResponseWriter) error {
+	if b.statusCode != 0 {
+		w.WriteHeader(b.statusCode)
+	}
+	_, err := w.Write(b.body.Bytes())
+	return err
+}
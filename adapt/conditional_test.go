@@ -0,0 +1,97 @@
+package adapt
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type taggedOutput struct {
+	Value string
+}
+
+func (t taggedOutput) ETag() string {
+	return t.Value
+}
+
+func (t taggedOutput) LastModified() time.Time {
+	return time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func TestConditionalNullaryFuncAdaptor(t *testing.T) {
+	calls := 0
+	adaptor, err := NewNullaryFuncAdaptor(
+		func(ctx context.Context) (taggedOutput, error) {
+			calls++
+			return taggedOutput{Value: "v1"}, nil
+		},
+		NewJSONEncoder[taggedOutput](),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		header string
+		value  string
+		status int
+	}{
+		{header: "", value: "", status: http.StatusOK},
+		{header: "If-None-Match", value: `"v1"`, status: http.StatusNotModified},
+		{header: "If-None-Match", value: `W/"v0", W/"v1"`, status: http.StatusNotModified},
+		{header: "If-None-Match", value: `"v0"`, status: http.StatusOK},
+		{header: "If-Modified-Since", value: "Sun, 01 Jan 2023 00:00:00 GMT", status: http.StatusNotModified},
+		{header: "If-Modified-Since", value: "Sat, 31 Dec 2022 00:00:00 GMT", status: http.StatusOK},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if c.header != "" {
+			r.Header.Set(c.header, c.value)
+		}
+		w := httptest.NewRecorder()
+		if err = adaptor.ServeHyperText(w, r); err != nil {
+			t.Fatal(err)
+		}
+		if w.Code != c.status {
+			t.Fatalf("%s: %s returned status %d instead of %d", c.header, c.value, w.Code, c.status)
+		}
+		if w.Header().Get("ETag") != `"v1"` {
+			t.Fatalf("unexpected ETag: %q", w.Header().Get("ETag"))
+		}
+		if c.status == http.StatusNotModified && w.Body.Len() > 0 {
+			t.Fatalf("not modified response has a body: %q", w.Body.String())
+		}
+	}
+}
+
+func TestHashingEncoder(t *testing.T) {
+	adaptor, err := NewNullaryFuncAdaptor(
+		func(ctx context.Context) (string, error) {
+			return "hashed", nil
+		},
+		NewHashingEncoder(NewJSONEncoder[string]()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	if err = adaptor.ServeHyperText(w, httptest.NewRequest(http.MethodGet, "/", nil)); err != nil {
+		t.Fatal(err)
+	}
+	tag := w.Header().Get("ETag")
+	if tag == "" || w.Body.String() != "\"hashed\"\n" {
+		t.Fatalf("unexpected response: %q %q", tag, w.Body.String())
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("If-None-Match", tag)
+	w = httptest.NewRecorder()
+	if err = adaptor.ServeHyperText(w, r); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusNotModified || w.Body.Len() > 0 {
+		t.Fatalf("unexpected response to a fresh copy: %d %q", w.Code, w.Body.String())
+	}
+}
@@ -27,17 +27,19 @@ func NewNullaryFuncAdaptor[O any](
 type NullaryFuncAdaptor[O any] struct {
 	domainCall func(context.Context) (O, error)
 	encoder    Encoder[O]
+	coalescer  *coalescer[O]
+	key        CoalescingKeyFunc
 }
 
 func (a *NullaryFuncAdaptor[O]) ServeHyperText(
 	w http.ResponseWriter,
 	r *http.Request,
 ) error {
-	response, err := a.domainCall(r.Context())
+	response, err := a.call(r)
 	if err != nil {
 		return err
 	}
-	if err = a.encoder.Encode(w, response); err != nil {
+	if err = encode(w, r, a.encoder, response); err != nil {
 		return fmt.Errorf("unable to encode: %w", err)
 	}
 	return nil
@@ -0,0 +1,417 @@
+package adapt
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	MergePatchContentType = "application/merge-patch+json"
+	JSONPatchContentType  = "application/json-patch+json"
+)
+
+type UnsupportedMediaTypeError struct {
+	contentType string
+}
+
+func (e *UnsupportedMediaTypeError) Error() string {
+	return "unsupported media type: " + e.contentType
+}
+
+func (e *UnsupportedMediaTypeError) HyperTextStatusCode() int {
+	return http.StatusUnsupportedMediaType
+}
+
+// Loader retrieves the current state of the resource targeted by a partial update request.
+type Loader[T any, V Validatable[T]] func(*http.Request) (V, error)
+
+// loaderError carries a [Loader] error through the decoder, so that it is not reported as an invalid request.
+type loaderError struct {
+	error
+}
+
+func (e *loaderError) Unwrap() error {
+	return e.error
+}
+
+type jsonPatchCodec[T any, V Validatable[T], O any] struct {
+	jsonEncoder[O]
+	load Loader[T, V]
+}
+
+// NewJSONPatchCodec creates a [Codec] for partial updates. The request body is applied onto the current resource provided by the loader as either an RFC 7396 merge patch or an RFC 6902 JSON patch depending on the Content-Type header. Plain JSON bodies are treated as merge patches. Since the adaptor validates the decoded value, [Validatable.Validate] runs against the merged result. Loader errors are returned as they are rather than as [InvalidRequestError], so a missing resource keeps its own status code.
+func NewJSONPatchCodec[T any, V Validatable[T], O any](load Loader[T, V]) Codec[T, V, O] {
+	if load == nil {
+		panic("cannot use a <nil> resource loader")
+	}
+	return &jsonPatchCodec[T, V, O]{load: load}
+}
+
+func (j *jsonPatchCodec[T, V, O]) Decode(
+	w http.ResponseWriter,
+	r *http.Request,
+) (V, Encoder[O], error) {
+	defer func() {
+		r.Body.Close()
+	}()
+	contentType := r.Header.Get("Content-Type")
+	mediaType := MergePatchContentType
+	if contentType != "" {
+		var err error
+		if mediaType, _, err = mime.ParseMediaType(contentType); err != nil {
+			return nil, nil, &UnsupportedMediaTypeError{contentType: contentType}
+		}
+	}
+
+	var apply func(document any, patch []byte) (any, error)
+	switch mediaType {
+	case MergePatchContentType, "application/json":
+		apply = func(document any, patch []byte) (any, error) {
+			var merge any
+			if err := unmarshalJSON(patch, &merge); err != nil {
+				return nil, err
+			}
+			return MergePatch(document, merge), nil
+		}
+	case JSONPatchContentType:
+		apply = func(document any, patch []byte) (any, error) {
+			var operations []JSONPatchOperation
+			if err := unmarshalJSON(patch, &operations); err != nil {
+				return nil, err
+			}
+			return ApplyJSONPatch(document, operations)
+		}
+	default:
+		return nil, nil, &UnsupportedMediaTypeError{contentType: contentType}
+	}
+
+	patch := &bytes.Buffer{}
+	if _, err := patch.ReadFrom(r.Body); err != nil {
+		return nil, nil, err
+	}
+	current, err := j.load(r)
+	if err != nil {
+		return nil, nil, &loaderError{err}
+	}
+	encoded, err := json.Marshal(current)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to encode current resource: %w", err)
+	}
+	var document any
+	if err = unmarshalJSON(encoded, &document); err != nil {
+		return nil, nil, err
+	}
+	if document, err = apply(document, patch.Bytes()); err != nil {
+		return nil, nil, err
+	}
+	if encoded, err = json.Marshal(document); err != nil {
+		return nil, nil, err
+	}
+	request := V(new(T))
+	if err = json.Unmarshal(encoded, request); err != nil {
+		return nil, nil, err
+	}
+	return request, j, nil
+}
+
+func unmarshalJSON(data []byte, value any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(value)
+}
+
+// MergePatch applies an RFC 7396 merge patch onto a decoded JSON document. Null patch values remove the corresponding fields.
+func MergePatch(document, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch // replaces document
+	}
+	documentObject, ok := document.(map[string]any)
+	if !ok {
+		documentObject = make(map[string]any)
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(documentObject, key)
+			continue
+		}
+		documentObject[key] = MergePatch(documentObject[key], value)
+	}
+	return documentObject
+}
+
+// JSONPatchOperation is a single RFC 6902 operation.
+type JSONPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// ApplyJSONPatch applies RFC 6902 operations onto a decoded JSON document.
+func ApplyJSONPatch(document any, operations []JSONPatchOperation) (_ any, err error) {
+	for i, operation := range operations {
+		if document, err = operation.apply(document); err != nil {
+			return nil, fmt.Errorf("JSON patch operation #%d %q at %q failed: %w", i, operation.Op, operation.Path, err)
+		}
+	}
+	return document, nil
+}
+
+func (o JSONPatchOperation) value() (value any, err error) {
+	if len(o.Value) == 0 {
+		return nil, errors.New("value is required")
+	}
+	if err = unmarshalJSON(o.Value, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (o JSONPatchOperation) apply(document any) (any, error) {
+	switch o.Op {
+	case "add":
+		value, err := o.value()
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(document, o.Path, value)
+	case "remove":
+		document, _, err := pointerRemove(document, o.Path)
+		return document, err
+	case "replace":
+		value, err := o.value()
+		if err != nil {
+			return nil, err
+		}
+		if o.Path == "" {
+			return value, nil
+		}
+		if document, _, err = pointerRemove(document, o.Path); err != nil {
+			return nil, err
+		}
+		return pointerAdd(document, o.Path, value)
+	case "move":
+		if strings.HasPrefix(o.Path, o.From+"/") {
+			return nil, errors.New("cannot move a value into its own child")
+		}
+		document, value, err := pointerRemove(document, o.From)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(document, o.Path, value)
+	case "copy":
+		value, err := pointerGet(document, o.From)
+		if err != nil {
+			return nil, err
+		}
+		encoded, err := json.Marshal(value) // deep copy
+		if err != nil {
+			return nil, err
+		}
+		if err = unmarshalJSON(encoded, &value); err != nil {
+			return nil, err
+		}
+		return pointerAdd(document, o.Path, value)
+	case "test":
+		expected, err := o.value()
+		if err != nil {
+			return nil, err
+		}
+		value, err := pointerGet(document, o.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(normalizeJSON(value), normalizeJSON(expected)) {
+			return nil, errors.New("test failed")
+		}
+		return document, nil
+	default:
+		return nil, errors.New("unknown operation")
+	}
+}
+
+func normalizeJSON(value any) any {
+	switch value := value.(type) {
+	case json.Number:
+		f, err := value.Float64()
+		if err != nil {
+			return value.String()
+		}
+		return f
+	case map[string]any:
+		result := make(map[string]any, len(value))
+		for key, child := range value {
+			result[key] = normalizeJSON(child)
+		}
+		return result
+	case []any:
+		result := make([]any, len(value))
+		for i, child := range value {
+			result[i] = normalizeJSON(child)
+		}
+		return result
+	default:
+		return value
+	}
+}
+
+// splitPointer parses an RFC 6901 JSON pointer into the parent pointer and the unescaped last token.
+func splitPointer(pointer string) (parent, token string, err error) {
+	if pointer == "" {
+		return "", "", nil
+	}
+	if pointer[0] != '/' {
+		return "", "", fmt.Errorf("JSON pointer %q must start with a slash", pointer)
+	}
+	i := strings.LastIndexByte(pointer, '/')
+	token = strings.NewReplacer("~1", "/", "~0", "~").Replace(pointer[i+1:])
+	return pointer[:i], token, nil
+}
+
+func arrayIndex(token string, length int, appending bool) (int, error) {
+	if appending && token == "-" {
+		return length, nil
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || (token != "0" && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	if index > length || (!appending && index == length) {
+		return 0, fmt.Errorf("array index %d is out of bounds", index)
+	}
+	return index, nil
+}
+
+func pointerGet(document any, pointer string) (any, error) {
+	if pointer == "" {
+		return document, nil
+	}
+	parentPointer, token, err := splitPointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	parent, err := pointerGet(document, parentPointer)
+	if err != nil {
+		return nil, err
+	}
+	switch parent := parent.(type) {
+	case map[string]any:
+		value, ok := parent[token]
+		if !ok {
+			return nil, fmt.Errorf("path %q does not exist", pointer)
+		}
+		return value, nil
+	case []any:
+		index, err := arrayIndex(token, len(parent), false)
+		if err != nil {
+			return nil, err
+		}
+		return parent[index], nil
+	default:
+		return nil, fmt.Errorf("path %q does not exist", pointer)
+	}
+}
+
+// pointerSet replaces the container at the pointer, which is required when a slice grows or shrinks.
+func pointerSet(document any, pointer string, value any) (any, error) {
+	if pointer == "" {
+		return value, nil
+	}
+	parentPointer, token, err := splitPointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	parent, err := pointerGet(document, parentPointer)
+	if err != nil {
+		return nil, err
+	}
+	switch parent := parent.(type) {
+	case map[string]any:
+		parent[token] = value
+		return document, nil
+	case []any:
+		index, err := arrayIndex(token, len(parent), false)
+		if err != nil {
+			return nil, err
+		}
+		parent[index] = value
+		return document, nil
+	default:
+		return nil, fmt.Errorf("path %q does not exist", pointer)
+	}
+}
+
+func pointerAdd(document any, pointer string, value any) (any, error) {
+	if pointer == "" {
+		return value, nil
+	}
+	parentPointer, token, err := splitPointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	parent, err := pointerGet(document, parentPointer)
+	if err != nil {
+		return nil, err
+	}
+	switch parent := parent.(type) {
+	case map[string]any:
+		parent[token] = value
+		return document, nil
+	case []any:
+		index, err := arrayIndex(token, len(parent), true)
+		if err != nil {
+			return nil, err
+		}
+		grown := make([]any, 0, len(parent)+1)
+		grown = append(grown, parent[:index]...)
+		grown = append(grown, value)
+		grown = append(grown, parent[index:]...)
+		return pointerSet(document, parentPointer, grown)
+	default:
+		return nil, fmt.Errorf("path %q does not exist", parentPointer)
+	}
+}
+
+func pointerRemove(document any, pointer string) (_ any, removed any, err error) {
+	if pointer == "" {
+		return nil, nil, errors.New("cannot remove the whole document")
+	}
+	parentPointer, token, err := splitPointer(pointer)
+	if err != nil {
+		return nil, nil, err
+	}
+	parent, err := pointerGet(document, parentPointer)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch parent := parent.(type) {
+	case map[string]any:
+		removed, ok := parent[token]
+		if !ok {
+			return nil, nil, fmt.Errorf("path %q does not exist", pointer)
+		}
+		delete(parent, token)
+		return document, removed, nil
+	case []any:
+		index, err := arrayIndex(token, len(parent), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		removed = parent[index]
+		shrunk := make([]any, 0, len(parent)-1)
+		shrunk = append(shrunk, parent[:index]...)
+		shrunk = append(shrunk, parent[index+1:]...)
+		document, err = pointerSet(document, parentPointer, shrunk)
+		return document, removed, err
+	default:
+		return nil, nil, fmt.Errorf("path %q does not exist", pointer)
+	}
+}
@@ -0,0 +1,127 @@
+package adapt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type profile struct {
+	Name  string
+	Age   int
+	Tags  []string
+	Email *string
+}
+
+func (p *profile) Validate() error {
+	if p.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+func TestJSONPatchCodec(t *testing.T) {
+	email := "old@example.com"
+	var updated *profile
+	adaptor, err := NewUnaryFuncAdaptor(
+		func(ctx context.Context, p *profile) (*profile, error) {
+			updated = p
+			return p, nil
+		},
+		NewJSONPatchCodec[profile, *profile, *profile](func(r *http.Request) (*profile, error) {
+			return &profile{Name: "Ann", Age: 30, Tags: []string{"a", "b"}, Email: &email}, nil
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		contentType string
+		body        string
+		status      int
+		expected    string
+	}{
+		{contentType: MergePatchContentType, body: `{"Age":0,"Email":null}`, status: http.StatusOK, expected: "Ann 0 [a b] <nil>"},
+		{contentType: MergePatchContentType, body: `{"Name":""}`, status: http.StatusUnprocessableEntity},
+		{contentType: JSONPatchContentType, body: `[{"op":"test","path":"/Age","value":30},{"op":"add","path":"/Tags/-","value":"c"},{"op":"remove","path":"/Tags/0"},{"op":"replace","path":"/Name","value":"Bob"}]`, status: http.StatusOK, expected: "Bob 30 [b c] old@example.com"},
+		{contentType: JSONPatchContentType, body: `[{"op":"test","path":"/Age","value":31}]`, status: http.StatusUnprocessableEntity},
+		{contentType: JSONPatchContentType, body: `[{"op":"move","from":"/Tags/1","path":"/Tags/0"}]`, status: http.StatusOK, expected: "Ann 30 [b a] old@example.com"},
+		{contentType: "text/plain", body: `{}`, status: http.StatusUnsupportedMediaType},
+	}
+	for _, c := range cases {
+		updated = nil
+		r := httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(c.body))
+		r.Header.Set("Content-Type", c.contentType)
+		err = adaptor.ServeHyperText(httptest.NewRecorder(), r)
+		status := http.StatusOK
+		var httpError interface{ HyperTextStatusCode() int }
+		if errors.As(err, &httpError) {
+			status = httpError.HyperTextStatusCode()
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if status != c.status {
+			t.Fatalf("%s returned status %d instead of %d: %v", c.body, status, c.status, err)
+		}
+		if c.expected == "" {
+			continue
+		}
+		result := fmt.Sprintf("%s %d %v", updated.Name, updated.Age, updated.Tags)
+		if updated.Email == nil {
+			result += " <nil>"
+		} else {
+			result += " " + *updated.Email
+		}
+		if result != c.expected {
+			t.Fatalf("%s produced %q instead of %q", c.body, result, c.expected)
+		}
+	}
+}
+
+type missingProfileError struct{}
+
+func (e *missingProfileError) Error() string {
+	return "profile not found"
+}
+
+func (e *missingProfileError) HyperTextStatusCode() int {
+	return http.StatusNotFound
+}
+
+func TestJSONPatchCodecLoaderErrors(t *testing.T) {
+	unavailable := errors.New("database down")
+	for expected, loaderErr := range map[int]error{
+		http.StatusNotFound:            &missingProfileError{},
+		http.StatusInternalServerError: unavailable,
+	} {
+		adaptor, err := NewVoidFuncAdaptor(
+			func(ctx context.Context, p *profile) error {
+				return nil
+			},
+			NewJSONPatchCodec[profile, *profile, profile](func(r *http.Request) (*profile, error) {
+				return nil, loaderErr
+			}),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(`{"Age":1}`))
+		err = adaptor.ServeHyperText(httptest.NewRecorder(), r)
+		if !errors.Is(err, loaderErr) {
+			t.Fatalf("loader error was replaced by: %v", err)
+		}
+		status := http.StatusInternalServerError
+		var httpError interface{ HyperTextStatusCode() int }
+		if errors.As(err, &httpError) {
+			status = httpError.HyperTextStatusCode()
+		}
+		if status != expected {
+			t.Fatalf("loader error %q returned status %d instead of %d", loaderErr, status, expected)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package adapt
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	ErrPreconditionFailed   = &PreconditionError{statusCode: http.StatusPreconditionFailed}
+	ErrPreconditionRequired = &PreconditionError{statusCode: http.StatusPreconditionRequired}
+)
+
+type PreconditionError struct {
+	statusCode int
+}
+
+func (e *PreconditionError) Error() string {
+	return http.StatusText(e.statusCode)
+}
+
+func (e *PreconditionError) HyperTextStatusCode() int {
+	return e.statusCode
+}
+
+// PreconditionPolicy determines whether mutations must carry If-Match or If-Unmodified-Since headers.
+type PreconditionPolicy uint8
+
+const (
+	PreconditionOptional PreconditionPolicy = iota
+	PreconditionRequired
+)
+
+// Version is the current state validator of a resource. It satisfies [Tagged] and [Dated]. The zero Version stands for a resource that does not exist.
+type Version struct {
+	Tag      string
+	Modified time.Time
+}
+
+func (v Version) ETag() string {
+	return v.Tag
+}
+
+func (v Version) LastModified() time.Time {
+	return v.Modified
+}
+
+// VersionFunc loads the current [Version] of the resource targeted by a request.
+type VersionFunc[T any, V Validatable[T]] func(context.Context, V) (Version, error)
+
+// checkPreconditions evaluates If-Match and If-Unmodified-Since headers against the current resource version.
+func checkPreconditions(r *http.Request, current Version, policy PreconditionPolicy) error {
+	if match := r.Header.Get("If-Match"); match != "" {
+		exists := current.Tag != "" || !current.Modified.IsZero()
+		tag := ""
+		if current.Tag != "" {
+			tag = quoteETag(current.Tag)
+		}
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" {
+				if exists {
+					return nil
+				}
+				continue
+			}
+			// weak tags never match strongly
+			if tag != "" && !strings.HasPrefix(tag, "W/") && candidate == tag {
+				return nil
+			}
+		}
+		return ErrPreconditionFailed
+	}
+
+	if value := r.Header.Get("If-Unmodified-Since"); value != "" {
+		since, err := http.ParseTime(value)
+		if err == nil {
+			if current.Modified.IsZero() || current.Modified.UTC().Truncate(time.Second).After(since) {
+				return ErrPreconditionFailed
+			}
+			return nil
+		}
+	}
+
+	if policy == PreconditionRequired {
+		return ErrPreconditionRequired
+	}
+	return nil
+}
+
+// NewVersionedUnaryFuncAdaptor creates a [UnaryFuncAdaptor] that checks request preconditions against the current resource [Version] before calling the mutation. It answers with [ErrPreconditionFailed] on mismatch and with [ErrPreconditionRequired], if the policy demands preconditions the request does not carry. The output should implement [Tagged] or [Dated] to emit the new validators.
+func NewVersionedUnaryFuncAdaptor[
+	T any,
+	V Validatable[T],
+	O any,
+](
+	domainCall func(context.Context, V) (O, error),
+	decoder Decoder[T, V, O],
+	version VersionFunc[T, V],
+	policy PreconditionPolicy,
+) (*UnaryFuncAdaptor[T, V, O], error) {
+	adaptor, err := NewUnaryFuncAdaptor(domainCall, decoder)
+	if err != nil {
+		return nil, err
+	}
+	if version == nil {
+		return nil, errors.New("cannot use a <nil> version function")
+	}
+	adaptor.version = version
+	adaptor.preconditionPolicy = policy
+	return adaptor, nil
+}
@@ -0,0 +1,100 @@
+package adapt
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type renameRequest struct {
+	Name string
+}
+
+func (r *renameRequest) Validate() error {
+	if r.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+func TestVersionedUnaryFuncAdaptor(t *testing.T) {
+	current := Version{Tag: "1"}
+	adaptor, err := NewVersionedUnaryFuncAdaptor(
+		func(ctx context.Context, r *renameRequest) (Version, error) {
+			current = Version{Tag: r.Name}
+			return current, nil
+		},
+		NewJSONCodec[renameRequest, *renameRequest, Version](),
+		func(ctx context.Context, r *renameRequest) (Version, error) {
+			return current, nil
+		},
+		PreconditionRequired,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		match  string
+		name   string
+		status int
+	}{
+		{match: "", name: "2", status: http.StatusPreconditionRequired},
+		{match: `"0"`, name: "2", status: http.StatusPreconditionFailed},
+		{match: `W/"1"`, name: "2", status: http.StatusPreconditionFailed},
+		{match: `"0", "1"`, name: "2", status: http.StatusOK},
+		{match: `"1"`, name: "3", status: http.StatusPreconditionFailed},
+		{match: "*", name: "3", status: http.StatusOK},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"Name":"`+c.name+`"}`))
+		if c.match != "" {
+			r.Header.Set("If-Match", c.match)
+		}
+		w := httptest.NewRecorder()
+		err = adaptor.ServeHyperText(w, r)
+		status := w.Code
+		var precondition *PreconditionError
+		if errors.As(err, &precondition) {
+			status = precondition.HyperTextStatusCode()
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if status != c.status {
+			t.Fatalf("If-Match: %s returned status %d instead of %d", c.match, status, c.status)
+		}
+		if status == http.StatusOK && w.Header().Get("ETag") != `"`+c.name+`"` {
+			t.Fatalf("new ETag was not emitted: %q", w.Header().Get("ETag"))
+		}
+	}
+}
+
+func TestIfMatchAnyVersion(t *testing.T) {
+	cases := []struct {
+		current Version
+		status  int
+	}{
+		{current: Version{Tag: "1"}},
+		{current: Version{Modified: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}},
+		{current: Version{}, status: http.StatusPreconditionFailed},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodPut, "/", nil)
+		r.Header.Set("If-Match", "*")
+		err := checkPreconditions(r, c.current, PreconditionRequired)
+		status := 0
+		var precondition *PreconditionError
+		if errors.As(err, &precondition) {
+			status = precondition.HyperTextStatusCode()
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if status != c.status {
+			t.Fatalf("If-Match: * against %+v returned status %d instead of %d", c.current, status, c.status)
+		}
+	}
+}
@@ -33,8 +33,10 @@ type UnaryFuncAdaptor[
 	V Validatable[T],
 	O any,
 ] struct {
-	domainCall func(context.Context, V) (O, error)
-	decoder    Decoder[T, V, O]
+	domainCall         func(context.Context, V) (O, error)
+	decoder            Decoder[T, V, O]
+	version            VersionFunc[T, V]
+	preconditionPolicy PreconditionPolicy
 }
 
 func (a *UnaryFuncAdaptor[T, V, O]) ServeHyperText(
@@ -43,17 +45,26 @@ func (a *UnaryFuncAdaptor[T, V, O]) ServeHyperText(
 ) error {
 	request, encoder, err := a.decoder.Decode(w, r)
 	if err != nil {
-		return NewInvalidRequestError(fmt.Errorf("unable to decode: %w", err))
+		return newDecodingError(err)
 	}
 	if err = request.Validate(); err != nil {
 		return NewInvalidRequestError(err)
 	}
+	if a.version != nil {
+		current, err := a.version(r.Context(), request)
+		if err != nil {
+			return err
+		}
+		if err = checkPreconditions(r, current, a.preconditionPolicy); err != nil {
+			return err
+		}
+	}
 
 	response, err := a.domainCall(r.Context(), request)
 	if err != nil {
 		return err
 	}
-	if err = encoder.Encode(w, response); err != nil {
+	if err = encode(w, r, encoder, response); err != nil {
 		return fmt.Errorf("unable to encode: %w", err)
 	}
 	return nil
@@ -63,6 +74,7 @@ type StringUnaryFuncAdaptor[O any] struct {
 	domainCall func(context.Context, string) (O, error)
 	extractor  func(*http.Request) (string, error)
 	encoder    Encoder[O]
+	coalescer  *coalescer[O]
 }
 
 func NewStringUnaryFuncAdaptor[O any](
@@ -96,11 +108,11 @@ func (a *StringUnaryFuncAdaptor[O]) ServeHyperText(
 		return NewInvalidRequestError(fmt.Errorf("unable to extract string: %w", err))
 	}
 
-	response, err := a.domainCall(r.Context(), request)
+	response, err := a.call(r, request)
 	if err != nil {
 		return err
 	}
-	if err = a.encoder.Encode(w, response); err != nil {
+	if err = encode(w, r, a.encoder, response); err != nil {
 		return fmt.Errorf("unable to encode: %w", err)
 	}
 	return nil
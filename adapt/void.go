@@ -41,7 +41,7 @@ func (a *VoidFuncAdaptor[T, V]) ServeHyperText(
 ) error {
 	request, _, err := a.decoder.Decode(w, r)
 	if err != nil {
-		return NewInvalidRequestError(fmt.Errorf("unable to decode: %w", err))
+		return newDecodingError(err)
 	}
 	if err = request.Validate(); err != nil {
 		return NewInvalidRequestError(err)
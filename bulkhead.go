@@ -0,0 +1,274 @@
+package oakmux
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultBulkheadQueueTimeout = time.Second
+	DefaultBulkheadRetryAfter   = time.Second
+)
+
+// OverloadError is returned by the [Bulkhead] when a route has no capacity left for the request.
+type OverloadError struct {
+	route      string
+	retryAfter time.Duration
+}
+
+func (e *OverloadError) Error() string {
+	return http.StatusText(http.StatusServiceUnavailable)
+}
+
+func (e *OverloadError) HyperTextStatusCode() int {
+	return http.StatusServiceUnavailable
+}
+
+func (e *OverloadError) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("message", "request shed by bulkhead"),
+		slog.String("route", e.route),
+		slog.Duration("retryAfter", e.retryAfter),
+	)
+}
+
+// BulkheadStats is a snapshot of a [Bulkhead] compartment.
+type BulkheadStats struct {
+	Route    string
+	Limit    int
+	Queue    int
+	InFlight int
+	Queued   int
+	Admitted uint64
+	Rejected uint64
+}
+
+type compartment struct {
+	slots    chan struct{}
+	queue    int
+	queued   atomic.Int64
+	admitted atomic.Uint64
+	rejected atomic.Uint64
+}
+
+func newCompartment(limit, queue int) *compartment {
+	return &compartment{
+		slots: make(chan struct{}, limit),
+		queue: queue,
+	}
+}
+
+func (c *compartment) stats(route string) BulkheadStats {
+	return BulkheadStats{
+		Route:    route,
+		Limit:    cap(c.slots),
+		Queue:    c.queue,
+		InFlight: len(c.slots),
+		Queued:   int(c.queued.Load()),
+		Admitted: c.admitted.Load(),
+		Rejected: c.rejected.Load(),
+	}
+}
+
+// Bulkhead isolates routes from each other by capping in-flight requests per [Route.Name]. Excess requests wait in a bounded queue and are shed with [OverloadError], when the queue is full or the wait times out.
+type Bulkhead struct {
+	mu           sync.Mutex
+	limit        int
+	queue        int
+	queueTimeout time.Duration
+	retryAfter   time.Duration
+	overrides    map[string][2]int
+	compartments map[string]*compartment
+}
+
+type bulkheadOptions struct {
+	limit        int
+	queue        int
+	queueTimeout time.Duration
+	retryAfter   time.Duration
+	overrides    map[string][2]int
+}
+
+type BulkheadOption func(*bulkheadOptions) error
+
+// WithBulkheadLimit sets the default number of in-flight requests and the wait queue length for each route.
+func WithBulkheadLimit(inFlight, queue int) BulkheadOption {
+	return func(o *bulkheadOptions) error {
+		if inFlight <= 0 {
+			return errors.New("in-flight request limit must be greater than 0")
+		}
+		if queue < 0 {
+			return errors.New("queue length cannot be negative")
+		}
+		if o.limit != 0 {
+			return fmt.Errorf("in-flight request limit is already set to: %d", o.limit)
+		}
+		o.limit = inFlight
+		o.queue = queue
+		return nil
+	}
+}
+
+// WithBulkheadRouteLimit overrides the limits for a route by name.
+func WithBulkheadRouteLimit(name string, inFlight, queue int) BulkheadOption {
+	return func(o *bulkheadOptions) error {
+		if name == "" {
+			return errors.New("cannot use an empty route name")
+		}
+		if inFlight <= 0 {
+			return errors.New("in-flight request limit must be greater than 0")
+		}
+		if queue < 0 {
+			return errors.New("queue length cannot be negative")
+		}
+		if _, ok := o.overrides[name]; ok {
+			return fmt.Errorf("route %q limit is already set", name)
+		}
+		o.overrides[name] = [2]int{inFlight, queue}
+		return nil
+	}
+}
+
+func WithBulkheadQueueTimeout(d time.Duration) BulkheadOption {
+	return func(o *bulkheadOptions) error {
+		if d <= 0 {
+			return errors.New("queue timeout must be greater than 0")
+		}
+		if o.queueTimeout != 0 {
+			return fmt.Errorf("queue timeout is already set to: %s", o.queueTimeout)
+		}
+		o.queueTimeout = d
+		return nil
+	}
+}
+
+// WithBulkheadRetryAfter sets the Retry-After header value for shed requests.
+func WithBulkheadRetryAfter(d time.Duration) BulkheadOption {
+	return func(o *bulkheadOptions) error {
+		if d <= 0 {
+			return errors.New("retry after duration must be greater than 0")
+		}
+		if o.retryAfter != 0 {
+			return fmt.Errorf("retry after duration is already set to: %s", o.retryAfter)
+		}
+		o.retryAfter = d
+		return nil
+	}
+}
+
+func NewBulkhead(withOptions ...BulkheadOption) (*Bulkhead, error) {
+	o := &bulkheadOptions{overrides: make(map[string][2]int)}
+	for _, option := range append(
+		withOptions,
+		func(o *bulkheadOptions) error {
+			if o.limit == 0 {
+				return errors.New("in-flight request limit is required")
+			}
+			if o.queueTimeout == 0 {
+				o.queueTimeout = DefaultBulkheadQueueTimeout
+			}
+			if o.retryAfter == 0 {
+				o.retryAfter = DefaultBulkheadRetryAfter
+			}
+			return nil
+		},
+	) {
+		if err := option(o); err != nil {
+			return nil, fmt.Errorf("cannot create bulkhead: %w", err)
+		}
+	}
+
+	return &Bulkhead{
+		limit:        o.limit,
+		queue:        o.queue,
+		queueTimeout: o.queueTimeout,
+		retryAfter:   o.retryAfter,
+		overrides:    o.overrides,
+		compartments: make(map[string]*compartment),
+	}, nil
+}
+
+func (b *Bulkhead) compartment(route string) *compartment {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, ok := b.compartments[route]
+	if !ok {
+		if override, ok := b.overrides[route]; ok {
+			c = newCompartment(override[0], override[1])
+		} else {
+			c = newCompartment(b.limit, b.queue)
+		}
+		b.compartments[route] = c
+	}
+	return c
+}
+
+// Middleware returns the [Middleware] that admits requests through the bulkhead. It must be attached to routes, because it takes the compartment name from the [RoutingContext], which is not available to the middleware of the whole multiplexer. Requests without it fail.
+func (b *Bulkhead) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+			routing := GetRoutingContext(r.Context())
+			if routing == nil {
+				return errors.New("bulkhead request has no routing context: attach the bulkhead to routes")
+			}
+			route := routing.Route().Name()
+			c := b.compartment(route)
+			if err := b.admit(r, c, route); err != nil {
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(b.retryAfter)))
+				return err
+			}
+			defer func() { <-c.slots }()
+			return next.ServeHyperText(w, r)
+		})
+	}
+}
+
+func (b *Bulkhead) admit(r *http.Request, c *compartment, route string) error {
+	select {
+	case c.slots <- struct{}{}:
+		c.admitted.Add(1)
+		return nil
+	default:
+	}
+
+	if c.queued.Add(1) > int64(c.queue) {
+		c.queued.Add(-1)
+		c.rejected.Add(1)
+		return &OverloadError{route: route, retryAfter: b.retryAfter}
+	}
+	defer c.queued.Add(-1)
+
+	timer := time.NewTimer(b.queueTimeout)
+	defer timer.Stop()
+	select {
+	case c.slots <- struct{}{}:
+		c.admitted.Add(1)
+		return nil
+	case <-timer.C:
+		c.rejected.Add(1)
+		return &OverloadError{route: route, retryAfter: b.retryAfter}
+	case <-r.Context().Done():
+		return r.Context().Err()
+	}
+}
+
+// Stats returns a snapshot of every route compartment sorted by route name.
+func (b *Bulkhead) Stats() []BulkheadStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stats := make([]BulkheadStats, 0, len(b.compartments))
+	for route, c := range b.compartments {
+		stats = append(stats, c.stats(route))
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Route < stats[j].Route
+	})
+	return stats
+}
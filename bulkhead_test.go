@@ -0,0 +1,79 @@
+package oakmux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBulkhead(t *testing.T) {
+	bulkhead, err := NewBulkhead(
+		WithBulkheadLimit(4, 4),
+		WithBulkheadRouteLimit("report", 1, 1),
+		WithBulkheadQueueTimeout(time.Millisecond*20),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	mux, err := New(
+		WithRouteHandler("report", "/report", HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) error {
+				entered <- struct{}{}
+				<-release
+				return nil
+			},
+		), bulkhead.Middleware()),
+		WithRouteHandler("cheap", "/cheap", newTestHandler(t), bulkhead.Middleware()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		expectFromRequest(mux, httptest.NewRequest(http.MethodGet, "/report", nil), http.StatusOK, "")(t)
+	}()
+	<-entered
+
+	// queued request times out
+	expectFromRequest(mux, httptest.NewRequest(http.MethodGet, "/report", nil), http.StatusServiceUnavailable, "")(t)
+	// other routes are not starved
+	expectFromRequest(mux, httptest.NewRequest(http.MethodGet, "/cheap", nil), http.StatusOK, "/cheap")(t)
+
+	close(release)
+	wg.Wait()
+
+	stats := bulkhead.Stats()
+	if len(stats) != 2 {
+		t.Fatalf("expected stats for two routes, got: %+v", stats)
+	}
+	if report := stats[1]; report.Route != "report" || report.Admitted != 1 || report.Rejected != 1 || report.InFlight != 0 {
+		t.Fatalf("unexpected report route stats: %+v", report)
+	}
+}
+
+func TestBulkheadRequiresRoutingContext(t *testing.T) {
+	bulkhead, err := NewBulkhead(WithBulkheadLimit(1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux, err := New(
+		WithMiddleware(bulkhead.Middleware()),
+		WithRouteHandler("cheap", "/cheap", newTestHandler(t)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = mux.ServeHyperText(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/cheap", nil)); err == nil {
+		t.Fatal("bulkhead admitted a request without a routing context")
+	}
+	if stats := bulkhead.Stats(); len(stats) != 0 {
+		t.Fatalf("requests without a routing context were counted: %+v", stats)
+	}
+}
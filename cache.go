@@ -0,0 +1,490 @@
+package oakmux
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/textproto"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultResponseCacheSizeLimit = 1 << 26 // 64MB
+	DefaultResponseCacheTTL       = time.Minute
+)
+
+type responseCacheEntry struct {
+	key                  string
+	route                string
+	response             *CapturedResponse
+	size                 int
+	stored               time.Time
+	expires              time.Time
+	staleWhileRevalidate time.Duration
+	revalidating         bool
+}
+
+// ResponseCache is a least recently used in-memory store of captured GET responses.
+type ResponseCache struct {
+	mu                   sync.Mutex
+	entries              map[string]*list.Element
+	recent               *list.List
+	routes               map[string]map[string]struct{}
+	size                 int
+	sizeLimit            int
+	ttl                  time.Duration
+	staleWhileRevalidate time.Duration
+	queryParameters      []string
+	varyHeaders          []string
+	principal            func(*http.Request) (string, bool)
+	refreshes            sync.WaitGroup
+}
+
+type responseCacheOptions struct {
+	sizeLimit            int
+	ttl                  time.Duration
+	staleWhileRevalidate time.Duration
+	queryParameters      []string
+	varyHeaders          []string
+	principal            func(*http.Request) (string, bool)
+}
+
+type ResponseCacheOption func(*responseCacheOptions) error
+
+// WithResponseCacheSizeLimitOf caps the total size of cached responses. Defaults to [DefaultResponseCacheSizeLimit].
+func WithResponseCacheSizeLimitOf(maximumBytes int) ResponseCacheOption {
+	return func(o *responseCacheOptions) error {
+		if maximumBytes <= 0 {
+			return errors.New("cache size limit must be greater than 0 bytes")
+		}
+		if o.sizeLimit != 0 {
+			return fmt.Errorf("cache size limit is already set to: %d", o.sizeLimit)
+		}
+		o.sizeLimit = maximumBytes
+		return nil
+	}
+}
+
+// WithResponseCacheTTL sets the freshness lifetime for responses without a Cache-Control max-age directive. Defaults to [DefaultResponseCacheTTL].
+func WithResponseCacheTTL(d time.Duration) ResponseCacheOption {
+	return func(o *responseCacheOptions) error {
+		if d <= 0 {
+			return errors.New("cache TTL must be greater than 0")
+		}
+		if o.ttl != 0 {
+			return fmt.Errorf("cache TTL is already set to: %s", o.ttl)
+		}
+		o.ttl = d
+		return nil
+	}
+}
+
+// WithResponseCacheStaleWhileRevalidate serves expired responses for the duration while refreshing them in the background. Responses can override it with the Cache-Control stale-while-revalidate directive.
+func WithResponseCacheStaleWhileRevalidate(d time.Duration) ResponseCacheOption {
+	return func(o *responseCacheOptions) error {
+		if d <= 0 {
+			return errors.New("stale while revalidate duration must be greater than 0")
+		}
+		if o.staleWhileRevalidate != 0 {
+			return fmt.Errorf("stale while revalidate duration is already set to: %s", o.staleWhileRevalidate)
+		}
+		o.staleWhileRevalidate = d
+		return nil
+	}
+}
+
+// WithResponseCacheQueryParameters includes the named query parameters in the cache key. Other query parameters are ignored.
+func WithResponseCacheQueryParameters(names ...string) ResponseCacheOption {
+	return func(o *responseCacheOptions) error {
+		if len(names) == 0 {
+			return errors.New("empty query parameter list")
+		}
+		for i, name := range names {
+			if name == "" {
+				return fmt.Errorf("query parameter #%d is empty", i)
+			}
+		}
+		o.queryParameters = append(o.queryParameters, names...)
+		return nil
+	}
+}
+
+// WithResponseCacheVaryHeaders includes the named request headers in the cache key. Responses that vary by any other header are not cached.
+func WithResponseCacheVaryHeaders(names ...string) ResponseCacheOption {
+	return func(o *responseCacheOptions) error {
+		if len(names) == 0 {
+			return errors.New("empty header list")
+		}
+		for i, name := range names {
+			if name == "" {
+				return fmt.Errorf("header #%d is empty", i)
+			}
+			o.varyHeaders = append(o.varyHeaders, textproto.CanonicalMIMEHeaderKey(name))
+		}
+		return nil
+	}
+}
+
+// WithResponseCachePrincipal includes the authenticated principal provided by the given function in the cache key, so that each principal gets its own copy of responses to requests with Authorization or Cookie headers. Without it, requests with a Cookie header bypass the cache, unless the header is listed in [WithResponseCacheVaryHeaders], and responses to requests with an Authorization header are only stored when marked public, s-maxage, or must-revalidate.
+func WithResponseCachePrincipal(principal func(*http.Request) (string, bool)) ResponseCacheOption {
+	return func(o *responseCacheOptions) error {
+		if principal == nil {
+			return errors.New("cannot use a <nil> principal function")
+		}
+		if o.principal != nil {
+			return errors.New("principal function is already set")
+		}
+		o.principal = principal
+		return nil
+	}
+}
+
+func NewResponseCache(withOptions ...ResponseCacheOption) (*ResponseCache, error) {
+	o := &responseCacheOptions{}
+	for _, option := range append(
+		withOptions,
+		func(o *responseCacheOptions) error {
+			if o.sizeLimit == 0 {
+				o.sizeLimit = DefaultResponseCacheSizeLimit
+			}
+			if o.ttl == 0 {
+				o.ttl = DefaultResponseCacheTTL
+			}
+			sort.Strings(o.queryParameters)
+			sort.Strings(o.varyHeaders)
+			return nil
+		},
+	) {
+		if err := option(o); err != nil {
+			return nil, fmt.Errorf("cannot create response cache: %w", err)
+		}
+	}
+
+	return &ResponseCache{
+		entries:              make(map[string]*list.Element),
+		recent:               list.New(),
+		routes:               make(map[string]map[string]struct{}),
+		sizeLimit:            o.sizeLimit,
+		ttl:                  o.ttl,
+		staleWhileRevalidate: o.staleWhileRevalidate,
+		queryParameters:      o.queryParameters,
+		varyHeaders:          o.varyHeaders,
+		principal:            o.principal,
+	}, nil
+}
+
+// key builds the cache key from the route name, matched path fields, selected query parameters, vary headers, and the principal. Personal keys belong to a single principal.
+func (c *ResponseCache) key(r *http.Request) (key, route string, personal bool) {
+	b := strings.Builder{}
+	if routing := GetRoutingContext(r.Context()); routing != nil {
+		route = routing.Route().Name()
+		_, _ = b.WriteString(route)
+		fields := routing.MatchedFields().bindings
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(&b, "|%s=%q", name, fields[name])
+		}
+	} else {
+		_, _ = b.WriteString(r.URL.Path)
+	}
+	if len(c.queryParameters) > 0 {
+		query := r.URL.Query()
+		for _, name := range c.queryParameters {
+			fmt.Fprintf(&b, "|?%s=%q", name, query[name])
+		}
+	}
+	for _, name := range c.varyHeaders {
+		fmt.Fprintf(&b, "|%s:%q", name, r.Header.Values(name))
+	}
+	if c.principal != nil {
+		var name string
+		if name, personal = c.principal(r); personal {
+			fmt.Fprintf(&b, "|@%q", name)
+		}
+	}
+	return b.String(), route, personal
+}
+
+// variesBy reports whether the canonical header name is included in the cache key.
+func (c *ResponseCache) variesBy(name string) bool {
+	index := sort.SearchStrings(c.varyHeaders, name)
+	return index < len(c.varyHeaders) && c.varyHeaders[index] == name
+}
+
+// isShared reports whether a response to a request with an Authorization header may be stored by a shared cache, see RFC 9111 section 3.5.
+func isShared(response *CapturedResponse) bool {
+	if response == nil {
+		return false
+	}
+	directives := cacheControl(response.Header)
+	for _, allowed := range [...]string{"public", "s-maxage", "must-revalidate"} {
+		if _, ok := directives[allowed]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheControl parses the directives of a Cache-Control header.
+func cacheControl(header http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, argument, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name == "" {
+				continue
+			}
+			directives[strings.ToLower(name)] = strings.Trim(argument, `"`)
+		}
+	}
+	return directives
+}
+
+func directiveSeconds(directives map[string]string, name string) (time.Duration, bool) {
+	value, ok := directives[name]
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// isCacheable reports whether the captured response may be stored, given the vary headers included in the key.
+func (c *ResponseCache) isCacheable(response *CapturedResponse) bool {
+	if response == nil || response.StatusCode != http.StatusOK {
+		return false
+	}
+	if response.Header.Get("Set-Cookie") != "" {
+		return false
+	}
+	directives := cacheControl(response.Header)
+	for _, forbidden := range [...]string{"no-store", "no-cache", "private"} {
+		if _, ok := directives[forbidden]; ok {
+			return false
+		}
+	}
+	for _, value := range response.Header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			if name == "*" || !c.variesBy(name) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Middleware returns the [Middleware] that serves GET and HEAD requests from the cache.
+func (c *ResponseCache) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				return next.ServeHyperText(w, r)
+			}
+			requestDirectives := cacheControl(r.Header)
+			if _, ok := requestDirectives["no-store"]; ok {
+				return next.ServeHyperText(w, r)
+			}
+			key, route, personal := c.key(r)
+			if !personal && r.Header.Get("Cookie") != "" && !c.variesBy("Cookie") {
+				return next.ServeHyperText(w, r) // response may depend on the session
+			}
+			authorized := !personal && r.Header.Get("Authorization") != ""
+			if _, ok := requestDirectives["no-cache"]; !ok {
+				if response, age, revalidate := c.get(key, time.Now()); response != nil {
+					if revalidate {
+						c.refreshes.Add(1)
+						go c.revalidate(next, r.Clone(context.WithoutCancel(r.Context())), key, route, authorized)
+					}
+					w.Header().Set("Age", strconv.Itoa(int(age.Seconds())))
+					return response.ServeHyperText(w, r)
+				}
+			}
+			if r.Method == http.MethodHead {
+				return next.ServeHyperText(w, r) // cannot capture a body
+			}
+
+			capture := newResponseCapture(w, c.sizeLimit)
+			if err := next.ServeHyperText(capture, r); err != nil {
+				return err
+			}
+			if response := capture.Response(); !authorized || isShared(response) {
+				c.set(key, route, response, time.Now())
+			}
+			return nil
+		})
+	}
+}
+
+// revalidate refreshes a stale entry in the background using a detached copy of the request, which must be cloned before the original request completes. The conditional and range headers of the client are removed, so that the handler produces the full response for the cache. A failed refresh leaves the stale entry to expire.
+func (c *ResponseCache) revalidate(next Handler, detached *http.Request, key, route string, authorized bool) {
+	defer func() {
+		defer c.refreshes.Done()
+		c.mu.Lock()
+		if element, ok := c.entries[key]; ok {
+			element.Value.(*responseCacheEntry).revalidating = false
+		}
+		c.mu.Unlock()
+		if recovered := recover(); recovered != nil {
+			slog.Error(
+				"response cache revalidation panicked",
+				slog.String("route", route),
+				slog.Any("panic", recovered),
+				slog.String("stack", string(debug.Stack())),
+			)
+		}
+	}()
+	for _, header := range [...]string{"If-None-Match", "If-Modified-Since", "Range", "If-Range"} {
+		detached.Header.Del(header)
+	}
+	capture := newResponseCapture(&discardResponseWriter{header: make(http.Header)}, c.sizeLimit)
+	if err := next.ServeHyperText(capture, detached); err != nil {
+		slog.Warn(
+			"response cache revalidation failed",
+			slog.String("route", route),
+			slog.Any("error", err),
+		)
+		return
+	}
+	if response := capture.Response(); !authorized || isShared(response) {
+		c.set(key, route, response, time.Now())
+	}
+}
+
+func (c *ResponseCache) get(key string, now time.Time) (
+	response *CapturedResponse,
+	age time.Duration,
+	revalidate bool,
+) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, 0, false
+	}
+	entry := element.Value.(*responseCacheEntry)
+	if now.After(entry.expires) {
+		if now.After(entry.expires.Add(entry.staleWhileRevalidate)) {
+			c.remove(element)
+			return nil, 0, false
+		}
+		if !entry.revalidating {
+			entry.revalidating = true
+			revalidate = true
+		}
+	}
+	c.recent.MoveToFront(element)
+	return entry.response, now.Sub(entry.stored), revalidate
+}
+
+func (c *ResponseCache) set(key, route string, response *CapturedResponse, now time.Time) {
+	if !c.isCacheable(response) {
+		return
+	}
+	directives := cacheControl(response.Header)
+	ttl, ok := directiveSeconds(directives, "s-maxage")
+	if !ok {
+		if ttl, ok = directiveSeconds(directives, "max-age"); !ok {
+			ttl = c.ttl
+		}
+	}
+	staleWhileRevalidate, ok := directiveSeconds(directives, "stale-while-revalidate")
+	if !ok {
+		staleWhileRevalidate = c.staleWhileRevalidate
+	}
+	if ttl == 0 && staleWhileRevalidate == 0 {
+		return
+	}
+	entry := &responseCacheEntry{
+		key:                  key,
+		route:                route,
+		response:             response,
+		size:                 len(key) + response.Size(),
+		stored:               now,
+		expires:              now.Add(ttl),
+		staleWhileRevalidate: staleWhileRevalidate,
+	}
+	if entry.size > c.sizeLimit {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	for c.size+entry.size > c.sizeLimit {
+		c.remove(c.recent.Back())
+	}
+	c.entries[key] = c.recent.PushFront(entry)
+	c.size += entry.size
+	keys, ok := c.routes[route]
+	if !ok {
+		keys = make(map[string]struct{})
+		c.routes[route] = keys
+	}
+	keys[key] = struct{}{}
+}
+
+func (c *ResponseCache) remove(element *list.Element) {
+	entry := c.recent.Remove(element).(*responseCacheEntry)
+	delete(c.entries, entry.key)
+	c.size -= entry.size
+	if keys, ok := c.routes[entry.route]; ok {
+		delete(keys, entry.key)
+		if len(keys) == 0 {
+			delete(c.routes, entry.route)
+		}
+	}
+}
+
+// Invalidate removes all cached responses of the route by name and returns the number of removed entries.
+func (c *ResponseCache) Invalidate(routeName string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := c.routes[routeName]
+	removed := len(keys)
+	for key := range keys {
+		c.remove(c.entries[key])
+	}
+	return removed
+}
+
+// Size returns the total size of cached responses in bytes.
+func (c *ResponseCache) Size() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (d *discardResponseWriter) Header() http.Header {
+	return d.header
+}
+
+func (d *discardResponseWriter) WriteHeader(int) {}
+
+func (d *discardResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
@@ -0,0 +1,164 @@
+package oakmux
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestResponseCache(t *testing.T) {
+	cache, err := NewResponseCache(
+		WithResponseCacheQueryParameters("page"),
+		WithResponseCacheTTL(time.Minute),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := 0
+	counter := HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		calls++
+		if r.URL.Query().Get("private") != "" {
+			w.Header().Set("Cache-Control", "private")
+		}
+		fmt.Fprintf(w, "%s %d", r.URL.Path, calls)
+		return nil
+	})
+	mux, err := New(
+		WithRouteHandler("inventory", "/inventory/[category]", counter, cache.Middleware()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(path string) *http.Request {
+		return httptest.NewRequest(http.MethodGet, path, nil)
+	}
+	expectFromRequest(mux, get("/inventory/shirts"), http.StatusOK, "/inventory/shirts 1")(t)
+	expectFromRequest(mux, get("/inventory/shirts?ignored=1"), http.StatusOK, "/inventory/shirts 1")(t)
+	expectFromRequest(mux, get("/inventory/shirts?page=2"), http.StatusOK, "/inventory/shirts 2")(t)
+	expectFromRequest(mux, get("/inventory/hats"), http.StatusOK, "/inventory/hats 3")(t)
+	expectFromRequest(mux, get("/inventory/hats?private=1"), http.StatusOK, "/inventory/hats 3")(t)
+
+	noCache := get("/inventory/shirts")
+	noCache.Header.Set("Cache-Control", "no-cache")
+	expectFromRequest(mux, noCache, http.StatusOK, "/inventory/shirts 4")(t)
+	expectFromRequest(mux, get("/inventory/shirts"), http.StatusOK, "/inventory/shirts 4")(t)
+
+	if removed := cache.Invalidate("inventory"); removed != 3 {
+		t.Fatalf("invalidated %d entries instead of 3", removed)
+	}
+	if cache.Size() != 0 {
+		t.Fatalf("cache size is %d after invalidation", cache.Size())
+	}
+	expectFromRequest(mux, get("/inventory/shirts"), http.StatusOK, "/inventory/shirts 5")(t)
+}
+
+func TestResponseCacheStaleWhileRevalidate(t *testing.T) {
+	cache, err := NewResponseCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := atomic.Int32{}
+	refreshed := make(chan http.Header, 1)
+	handler := cache.Middleware()(HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		w.Header().Set("Cache-Control", "max-age=0, stale-while-revalidate=60")
+		fmt.Fprintf(w, "%d", calls.Add(1))
+		if calls.Load() > 1 {
+			refreshed <- r.Header
+		}
+		return nil
+	}))
+
+	expectFromRequest(handler, httptest.NewRequest(http.MethodGet, "/", nil), http.StatusOK, "1")(t)
+	cache.mu.Lock()
+	for _, element := range cache.entries {
+		element.Value.(*responseCacheEntry).expires = time.Now().Add(-time.Second)
+	}
+	cache.mu.Unlock()
+	conditional := httptest.NewRequest(http.MethodGet, "/", nil)
+	conditional.Header.Set("If-None-Match", `"1"`)
+	conditional.Header.Set("If-Modified-Since", time.Now().UTC().Format(http.TimeFormat))
+	conditional.Header.Set("Range", "bytes=0-0")
+	conditional.Header.Set("If-Range", `"1"`)
+	expectFromRequest(handler, conditional, http.StatusOK, "1")(t)
+	for header := range <-refreshed {
+		switch header {
+		case "If-None-Match", "If-Modified-Since", "Range", "If-Range":
+			t.Fatalf("revalidation request kept the %s header of the client", header)
+		}
+	}
+	cache.refreshes.Wait()
+	expectFromRequest(handler, httptest.NewRequest(http.MethodGet, "/", nil), http.StatusOK, "2")(t)
+}
+
+func TestResponseCachePrincipals(t *testing.T) {
+	secret := HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		if r.URL.Query().Get("public") != "" {
+			w.Header().Set("Cache-Control", "public")
+		}
+		fmt.Fprintf(w, "secret of %s%s", r.Header.Get("Authorization"), r.Header.Get("Cookie"))
+		return nil
+	})
+	request := func(path, header, value string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set(header, value)
+		return r
+	}
+
+	cache, err := NewResponseCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := cache.Middleware()(secret)
+	expectFromRequest(handler, request("/", "Authorization", "Bearer alice"), http.StatusOK, "secret of Bearer alice")(t)
+	expectFromRequest(handler, request("/", "Authorization", "Bearer bob"), http.StatusOK, "secret of Bearer bob")(t)
+	expectFromRequest(handler, request("/", "Cookie", "session=alice"), http.StatusOK, "secret of session=alice")(t)
+	expectFromRequest(handler, request("/", "Cookie", "session=bob"), http.StatusOK, "secret of session=bob")(t)
+	expectFromRequest(handler, request("/?public=1", "Authorization", "Bearer alice"), http.StatusOK, "secret of Bearer alice")(t)
+	expectFromRequest(handler, request("/?public=1", "Authorization", "Bearer bob"), http.StatusOK, "secret of Bearer alice")(t)
+
+	cache, err = NewResponseCache(WithResponseCachePrincipal(func(r *http.Request) (string, bool) {
+		name := r.Header.Get("Authorization")
+		return name, name != ""
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := 0
+	handler = cache.Middleware()(HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		calls++
+		return secret(w, r)
+	}))
+	expectFromRequest(handler, request("/", "Authorization", "Bearer alice"), http.StatusOK, "secret of Bearer alice")(t)
+	expectFromRequest(handler, request("/", "Authorization", "Bearer bob"), http.StatusOK, "secret of Bearer bob")(t)
+	expectFromRequest(handler, request("/", "Authorization", "Bearer alice"), http.StatusOK, "secret of Bearer alice")(t)
+	if calls != 2 {
+		t.Fatalf("handler was called %d times instead of 2", calls)
+	}
+}
+
+func TestResponseCacheEviction(t *testing.T) {
+	cache, err := NewResponseCache(WithResponseCacheSizeLimitOf(64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for i := 0; i < 4; i++ {
+		cache.set(fmt.Sprintf("key%d", i), "route", &CapturedResponse{
+			StatusCode: http.StatusOK,
+			Body:       make([]byte, 20),
+		}, now)
+	}
+	if cache.Size() > 64 {
+		t.Fatalf("cache size %d exceeds the limit", cache.Size())
+	}
+	if response, _, _ := cache.get("key0", now); response != nil {
+		t.Fatal("least recently used entry was not evicted")
+	}
+	if response, _, _ := cache.get("key3", now); response == nil {
+		t.Fatal("most recent entry was evicted")
+	}
+}
@@ -0,0 +1,228 @@
+package oakmux
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type canonicalOptions struct {
+	host            string
+	port            string
+	https           bool
+	proxies         trustedProxies
+	strictTransport string // Strict-Transport-Security header value
+}
+
+type CanonicalOption func(*canonicalOptions) error
+
+// WithCanonicalHost redirects requests for any other host name, like "www.example.com", to the canonical one, like "example.com". Requests keep their non-default port, unless the canonical host sets one, like "example.com:8443", or the scheme changes.
+func WithCanonicalHost(host string) CanonicalOption {
+	return func(o *canonicalOptions) error {
+		if host == "" {
+			return errors.New("cannot use an empty canonical host name")
+		}
+		if o.host != "" {
+			return fmt.Errorf("canonical host is already set to %q", o.host)
+		}
+		port := hostPort(host)
+		if port != "" && o.port != "" {
+			return fmt.Errorf("canonical port is already set to %q", o.port)
+		}
+		o.host = normalizeHost(host)
+		if port != "" {
+			o.port = port
+		}
+		return nil
+	}
+}
+
+// WithCanonicalPort redirects requests for any other port to the canonical one, like "8443" for HTTPS served on a non-default port.
+func WithCanonicalPort(port string) CanonicalOption {
+	return func(o *canonicalOptions) error {
+		number, err := strconv.Atoi(port)
+		if err != nil || number < 1 || number > 65535 {
+			return fmt.Errorf("invalid canonical port %q", port)
+		}
+		if o.port != "" {
+			return fmt.Errorf("canonical port is already set to %q", o.port)
+		}
+		o.port = port
+		return nil
+	}
+}
+
+// WithHTTPS redirects plain HTTP requests to HTTPS. The port of the plain HTTP request is dropped, because it cannot serve HTTPS, so use [WithCanonicalPort] when HTTPS is not served on the default port.
+func WithHTTPS() CanonicalOption {
+	return func(o *canonicalOptions) error {
+		if o.https {
+			return errors.New("HTTPS is already enforced")
+		}
+		o.https = true
+		return nil
+	}
+}
+
+// WithTrustedForwardedProto believes the X-Forwarded-Proto header of requests that arrive from the trusted reverse proxies, given as IP addresses or CIDR networks, which terminate TLS. The same proxies are trusted with the X-Forwarded-Host header, which a host multiplexer only believes with [WithTrustedForwardedHost].
+func WithTrustedForwardedProto(proxies ...string) CanonicalOption {
+	return func(o *canonicalOptions) (err error) {
+		if o.proxies != nil {
+			return errors.New("trusted proxies are already set")
+		}
+		if o.proxies, err = newTrustedProxies(proxies); err != nil {
+			return err
+		}
+		return nil
+	}
+}
+
+// WithStrictTransportSecurity sends the Strict-Transport-Security header with HTTPS responses, which makes browsers use HTTPS for the host for the given duration.
+func WithStrictTransportSecurity(maxAge time.Duration, includeSubdomains, preload bool) CanonicalOption {
+	return func(o *canonicalOptions) error {
+		if maxAge < time.Second {
+			return errors.New("strict transport security maximum age must be at least one second")
+		}
+		if o.strictTransport != "" {
+			return errors.New("strict transport security is already set")
+		}
+		o.strictTransport = "max-age=" + strconv.FormatInt(int64(maxAge/time.Second), 10)
+		if includeSubdomains {
+			o.strictTransport += "; includeSubDomains"
+		}
+		if preload {
+			o.strictTransport += "; preload"
+		}
+		return nil
+	}
+}
+
+func newCanonicalOptions(withOptions []CanonicalOption) (*canonicalOptions, error) {
+	o := &canonicalOptions{}
+	for _, option := range append(
+		withOptions,
+		func(o *canonicalOptions) error {
+			if o.host == "" && !o.https {
+				return errors.New("either canonical host or HTTPS must be set")
+			}
+			return nil
+		},
+	) {
+		if err := option(o); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+// scheme returns "https" for requests received over TLS or forwarded as such by a trusted proxy.
+func (o *canonicalOptions) scheme(r *http.Request) string {
+	if forwarded := o.proxies.forwarded(r, "X-Forwarded-Proto"); forwarded != "" {
+		return strings.ToLower(forwarded)
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// hostPort returns the port of the host or an empty string.
+func hostPort(host string) string {
+	if _, port, err := net.SplitHostPort(host); err == nil {
+		return port
+	}
+	return ""
+}
+
+// withoutDefaultPort returns an empty string for the default port of the scheme.
+func withoutDefaultPort(scheme, port string) string {
+	if (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		return ""
+	}
+	return port
+}
+
+// canonicalURL returns the URL the request should be redirected to or an empty string, if the request is already canonical.
+func (o *canonicalOptions) canonicalURL(r *http.Request) string {
+	scheme := o.scheme(r)
+	host := requestHost(r, o.proxies)
+	raw := o.proxies.forwarded(r, "X-Forwarded-Host")
+	if raw == "" {
+		raw = r.Host
+	}
+	if raw == "" {
+		raw = r.URL.Host
+	}
+	port := withoutDefaultPort(scheme, hostPort(raw))
+	canonicalScheme, canonicalHost, canonicalPort := scheme, host, port
+	if o.https {
+		canonicalScheme = "https"
+	}
+	if o.host != "" {
+		canonicalHost = o.host
+	}
+	if o.port != "" {
+		canonicalPort = o.port
+	} else if canonicalScheme != scheme {
+		canonicalPort = "" // the request port serves the other scheme
+	}
+	canonicalPort = withoutDefaultPort(canonicalScheme, canonicalPort)
+	if canonicalScheme == scheme && canonicalHost == host && canonicalPort == port {
+		return ""
+	}
+	if strings.Contains(canonicalHost, ":") {
+		canonicalHost = "[" + canonicalHost + "]" // IPv6 literal
+	}
+	if canonicalPort != "" {
+		canonicalHost += ":" + canonicalPort
+	}
+	return canonicalScheme + "://" + canonicalHost + r.URL.RequestURI()
+}
+
+func (o *canonicalOptions) setStrictTransportSecurity(w http.ResponseWriter, r *http.Request) {
+	if o.strictTransport != "" && o.scheme(r) == "https" {
+		w.Header().Set("Strict-Transport-Security", o.strictTransport)
+	}
+}
+
+// NewCanonicalRedirect creates a [Handler] that permanently redirects every request to the canonical host and scheme, preserving the path and the query. It is meant to be the default handler of a host multiplexer, see [WithDefaultHostHandler]. Requests that are already canonical fail with [UnknownHostError], which prevents redirect loops.
+func NewCanonicalRedirect(withOptions ...CanonicalOption) (Handler, error) {
+	o, err := newCanonicalOptions(withOptions)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create canonical redirect: %w", err)
+	}
+	return HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		target := o.canonicalURL(r)
+		if target == "" {
+			return &UnknownHostError{host: requestHost(r, o.proxies)}
+		}
+		o.setStrictTransportSecurity(w, r)
+		return (&redirect{
+			location:   target,
+			statusCode: http.StatusPermanentRedirect,
+		}).ServeHyperText(w, r)
+	}), nil
+}
+
+// NewCanonicalMiddleware creates a [Middleware] that permanently redirects requests for other hosts or over plain HTTP to the canonical host and scheme, preserving the path and the query. Canonical requests pass through with the Strict-Transport-Security header, when configured.
+func NewCanonicalMiddleware(withOptions ...CanonicalOption) (Middleware, error) {
+	o, err := newCanonicalOptions(withOptions)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create canonical middleware: %w", err)
+	}
+	return func(next Handler) Handler {
+		return HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+			o.setStrictTransportSecurity(w, r)
+			if target := o.canonicalURL(r); target != "" {
+				return (&redirect{
+					location:   target,
+					statusCode: http.StatusPermanentRedirect,
+				}).ServeHyperText(w, r)
+			}
+			return next.ServeHyperText(w, r)
+		})
+	}, nil
+}
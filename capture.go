@@ -0,0 +1,139 @@
+package oakmux
+
+import (
+	"bytes"
+	"net/http"
+	"slices"
+)
+
+// CapturedResponse is a recorded [http.ResponseWriter] output that can be replayed.
+type CapturedResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// ServeHyperText replays the captured response.
+func (c *CapturedResponse) ServeHyperText(
+	w http.ResponseWriter,
+	r *http.Request,
+) error {
+	header := w.Header()
+	for key, values := range c.Header {
+		header[key] = append([]string(nil), values...)
+	}
+	statusCode := c.StatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	w.WriteHeader(statusCode)
+	if r.Method == http.MethodHead {
+		return nil
+	}
+	_, err := w.Write(c.Body)
+	return err
+}
+
+// Size returns the approximate memory footprint of the response.
+func (c *CapturedResponse) Size() int {
+	size := len(c.Body)
+	for key, values := range c.Header {
+		size += len(key)
+		for _, value := range values {
+			size += len(value)
+		}
+	}
+	return size
+}
+
+// responseCapture writes through to the underlying [http.ResponseWriter]
+// while recording the status, headers, and body. Only the headers set after
+// the capture began are recorded, so that the headers of outer middleware
+// are not replayed. Recording stops when the body grows past the limit,
+// which marks the capture as overflown.
+type responseCapture struct {
+	http.ResponseWriter
+	statusCode int
+	baseline   http.Header
+	header     http.Header
+	body       bytes.Buffer
+	limit      int
+	overflown  bool
+}
+
+func newResponseCapture(w http.ResponseWriter, limit int) *responseCapture {
+	return &responseCapture{
+		ResponseWriter: w,
+		baseline:       w.Header().Clone(),
+		limit:          limit,
+	}
+}
+
+// changedHeaders returns the headers that differ from the baseline.
+func (c *responseCapture) changedHeaders() http.Header {
+	changed := make(http.Header)
+	for key, values := range c.ResponseWriter.Header() {
+		if slices.Equal(c.baseline[key], values) {
+			continue
+		}
+		changed[key] = slices.Clone(values)
+	}
+	return changed
+}
+
+func (c *responseCapture) WriteHeader(statusCode int) {
+	if c.statusCode != 0 {
+		return // superfluous
+	}
+	c.statusCode = statusCode
+	c.header = c.changedHeaders()
+	c.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (c *responseCapture) Write(b []byte) (int, error) {
+	if c.statusCode == 0 {
+		c.WriteHeader(http.StatusOK)
+	}
+	if !c.overflown {
+		if c.limit > 0 && c.body.Len()+len(b) > c.limit {
+			c.overflown = true
+			c.body.Reset()
+		} else {
+			_, _ = c.body.Write(b)
+		}
+	}
+	return c.ResponseWriter.Write(b)
+}
+
+func (c *responseCapture) Flush() {
+	if c.statusCode == 0 {
+		c.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := c.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to [http.ResponseController].
+func (c *responseCapture) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// Response returns the recorded response or <nil>, if nothing was written
+// or the body overflowed the recording limit.
+func (c *responseCapture) Response() *CapturedResponse {
+	if c.overflown {
+		return nil
+	}
+	if c.statusCode == 0 {
+		return &CapturedResponse{
+			StatusCode: http.StatusOK,
+			Header:     c.changedHeaders(),
+		}
+	}
+	return &CapturedResponse{
+		StatusCode: c.statusCode,
+		Header:     c.header,
+		Body:       bytes.Clone(c.body.Bytes()),
+	}
+}
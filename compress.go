@@ -0,0 +1,403 @@
+package oakmux
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const DefaultCompressionMinimumSize = 1024
+
+// alreadyCompressedContentTypes are skipped by default, because compressing them wastes processing time.
+var alreadyCompressedContentTypes = []string{
+	"image/",
+	"audio/",
+	"video/",
+	"font/woff",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/x-bzip2",
+	"application/x-7z-compressed",
+	"application/x-rar-compressed",
+	"application/zstd",
+	"application/wasm",
+	"text/event-stream", // compressing breaks incremental delivery in some clients
+}
+
+type compressionOptions struct {
+	level        int
+	levelSet     bool
+	minimumSize  int
+	skippedTypes []string
+}
+
+type CompressionOption func(*compressionOptions) error
+
+// WithCompressionLevel sets the gzip and deflate compression level from [flate.HuffmanOnly] to [flate.BestCompression].
+func WithCompressionLevel(level int) CompressionOption {
+	return func(o *compressionOptions) error {
+		if level < flate.HuffmanOnly || level > flate.BestCompression {
+			return fmt.Errorf("invalid compression level: %d", level)
+		}
+		if o.levelSet {
+			return fmt.Errorf("compression level is already set to: %d", o.level)
+		}
+		o.level = level
+		o.levelSet = true
+		return nil
+	}
+}
+
+// WithCompressionMinimumSizeOf leaves responses smaller than the given number of bytes uncompressed. Defaults to [DefaultCompressionMinimumSize].
+func WithCompressionMinimumSizeOf(minimumBytes int) CompressionOption {
+	return func(o *compressionOptions) error {
+		if minimumBytes <= 0 {
+			return errors.New("minimum size must be greater than 0 bytes")
+		}
+		if o.minimumSize != 0 {
+			return fmt.Errorf("minimum size is already set to: %d", o.minimumSize)
+		}
+		o.minimumSize = minimumBytes
+		return nil
+	}
+}
+
+// WithCompressionSkippedContentTypes adds content type prefixes that are never compressed in addition to the common already compressed formats.
+func WithCompressionSkippedContentTypes(prefixes ...string) CompressionOption {
+	return func(o *compressionOptions) error {
+		if len(prefixes) == 0 {
+			return errors.New("empty content type list")
+		}
+		for i, prefix := range prefixes {
+			if prefix == "" {
+				return fmt.Errorf("content type #%d is empty", i)
+			}
+		}
+		o.skippedTypes = append(o.skippedTypes, prefixes...)
+		return nil
+	}
+}
+
+// NewCompressionMiddleware creates a [Middleware] that compresses responses with gzip or deflate according to the Accept-Encoding request header. Routes can opt out using [SkipCompression].
+//
+// Compressed responses carry the entity tag of the handler with the encoding appended, like "abc-gzip", so that caches do not confuse the representations. The suffix is removed from the If-Match and If-None-Match headers of requests before they reach the handler, which keeps strong comparisons working.
+func NewCompressionMiddleware(withOptions ...CompressionOption) (Middleware, error) {
+	o := &compressionOptions{}
+	for _, option := range append(
+		withOptions,
+		func(o *compressionOptions) error {
+			if !o.levelSet {
+				o.level = flate.DefaultCompression
+			}
+			if o.minimumSize == 0 {
+				o.minimumSize = DefaultCompressionMinimumSize
+			}
+			o.skippedTypes = append(o.skippedTypes, alreadyCompressedContentTypes...)
+			return nil
+		},
+	) {
+		if err := option(o); err != nil {
+			return nil, fmt.Errorf("cannot create compression middleware: %w", err)
+		}
+	}
+
+	level := o.level
+	pools := map[string]*sync.Pool{
+		"gzip": {New: func() any {
+			w, _ := gzip.NewWriterLevel(nil, level)
+			return w
+		}},
+		"deflate": {New: func() any {
+			w, _ := flate.NewWriter(nil, level)
+			return w
+		}},
+	}
+
+	return func(next Handler) Handler {
+		return HandlerFunc(func(w http.ResponseWriter, r *http.Request) (err error) {
+			AddVary(w.Header(), "Accept-Encoding")
+			r = withoutEncodedETags(r)
+			encoding := NegotiateContentEncoding(r.Header.Get("Accept-Encoding"), "gzip", "deflate")
+			if encoding == "" || r.Method == http.MethodHead {
+				return next.ServeHyperText(w, r)
+			}
+			cw := &compressionWriter{
+				ResponseWriter: w,
+				encoding:       encoding,
+				pool:           pools[encoding],
+				minimumSize:    o.minimumSize,
+				skippedTypes:   o.skippedTypes,
+			}
+			defer func() {
+				err = errors.Join(err, cw.Close())
+			}()
+			return next.ServeHyperText(cw, r)
+		})
+	}, nil
+}
+
+// withoutEncodedETags returns a shallow copy of the request with the encoding suffixes removed from the entity tags of its If-Match and If-None-Match headers.
+func withoutEncodedETags(r *http.Request) *http.Request {
+	var stripped http.Header
+	for _, name := range [...]string{"If-Match", "If-None-Match"} {
+		value := r.Header.Get(name)
+		if value == "" {
+			continue
+		}
+		tags := strings.Split(value, ",")
+		changed := false
+		for i, tag := range tags {
+			tag = strings.TrimSpace(tag)
+			for _, encoding := range [...]string{"gzip", "deflate"} {
+				if suffix := "-" + encoding + `"`; strings.HasSuffix(tag, suffix) {
+					tags[i], changed = tag[:len(tag)-len(suffix)]+`"`, true
+					break
+				}
+			}
+		}
+		if !changed {
+			continue
+		}
+		if stripped == nil {
+			stripped = r.Header.Clone()
+		}
+		stripped.Set(name, strings.Join(tags, ","))
+	}
+	if stripped == nil {
+		return r
+	}
+	copied := *r
+	copied.Header = stripped
+	return &copied
+}
+
+// SkipCompression is a [Middleware] that disables response compression for a route.
+func SkipCompression(next Handler) Handler {
+	return HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		for current := w; current != nil; {
+			if cw, ok := current.(*compressionWriter); ok {
+				cw.bypass = true
+				break
+			}
+			unwrapper, ok := current.(interface{ Unwrap() http.ResponseWriter })
+			if !ok {
+				break
+			}
+			current = unwrapper.Unwrap()
+		}
+		return next.ServeHyperText(w, r)
+	})
+}
+
+// AddVary lists the request header name in the Vary response header, unless it is already listed, so that stacked handlers do not repeat it.
+func AddVary(header http.Header, name string) {
+	for _, value := range header.Values("Vary") {
+		for _, listed := range strings.Split(value, ",") {
+			listed = strings.TrimSpace(listed)
+			if listed == "*" || strings.EqualFold(listed, name) {
+				return
+			}
+		}
+	}
+	header.Add("Vary", name)
+}
+
+// NegotiateContentEncoding picks the available encoding with the highest quality value from the Accept-Encoding header. Ties are resolved in the order of the available encodings. Returns an empty string, if none of them is acceptable.
+func NegotiateContentEncoding(header string, available ...string) string {
+	if header == "" {
+		return ""
+	}
+	qualities := map[string]float64{}
+	wildcard := -1.0
+	for _, part := range strings.Split(header, ",") {
+		name, parameters, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		quality := 1.0
+		if key, value, ok := strings.Cut(strings.TrimSpace(parameters), "="); ok && strings.TrimSpace(key) == "q" {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+		if name == "*" {
+			wildcard = quality
+			continue
+		}
+		qualities[name] = quality
+	}
+
+	best, bestQuality := "", 0.0
+	for _, encoding := range available {
+		quality, ok := qualities[encoding]
+		if !ok {
+			quality = wildcard
+		}
+		if quality > bestQuality {
+			best, bestQuality = encoding, quality
+		}
+	}
+	return best
+}
+
+// compressionWriter buffers the beginning of the body until it can decide whether compression is worthwhile.
+type compressionWriter struct {
+	http.ResponseWriter
+	encoding     string
+	pool         *sync.Pool
+	minimumSize  int
+	skippedTypes []string
+	bypass       bool
+
+	statusCode int
+	buffer     []byte
+	decided    bool
+	compressor interface {
+		io.WriteCloser
+		Flush() error
+		Reset(io.Writer)
+	}
+}
+
+func (c *compressionWriter) WriteHeader(statusCode int) {
+	if c.statusCode != 0 {
+		return // superfluous
+	}
+	if statusCode < http.StatusOK && statusCode != http.StatusSwitchingProtocols {
+		c.ResponseWriter.WriteHeader(statusCode) // informational
+		return
+	}
+	c.statusCode = statusCode
+}
+
+func (c *compressionWriter) Write(b []byte) (int, error) {
+	if c.statusCode == 0 {
+		c.statusCode = http.StatusOK
+	}
+	if c.decided {
+		if c.compressor != nil {
+			return c.compressor.Write(b)
+		}
+		return c.ResponseWriter.Write(b)
+	}
+	c.buffer = append(c.buffer, b...)
+	if len(c.buffer) >= c.minimumSize {
+		if err := c.decide(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+func (c *compressionWriter) shouldCompress() bool {
+	if c.bypass || len(c.buffer) < c.minimumSize {
+		return false
+	}
+	switch c.statusCode {
+	case http.StatusNoContent, http.StatusNotModified, http.StatusPartialContent:
+		return false
+	}
+	header := c.ResponseWriter.Header()
+	if header.Get("Content-Encoding") != "" || header.Get("Content-Range") != "" {
+		return false
+	}
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(c.buffer)
+	}
+	contentType = strings.ToLower(contentType)
+	for _, prefix := range c.skippedTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// decide flushes the buffered headers and body either through the compressor or directly.
+func (c *compressionWriter) decide() (err error) {
+	if c.decided {
+		return nil
+	}
+	c.decided = true
+	if c.statusCode == 0 {
+		c.statusCode = http.StatusOK
+	}
+	if c.shouldCompress() {
+		header := c.ResponseWriter.Header()
+		header.Del("Content-Length")
+		header.Set("Content-Encoding", c.encoding)
+		if tag := header.Get("ETag"); strings.HasSuffix(tag, `"`) && len(tag) > 1 {
+			header.Set("ETag", tag[:len(tag)-1]+"-"+c.encoding+`"`) // representation differs
+		}
+		c.compressor = c.pool.Get().(interface {
+			io.WriteCloser
+			Flush() error
+			Reset(io.Writer)
+		})
+		c.compressor.Reset(c.ResponseWriter)
+		c.ResponseWriter.WriteHeader(c.statusCode)
+		if len(c.buffer) > 0 {
+			_, err = c.compressor.Write(c.buffer)
+		}
+	} else {
+		c.ResponseWriter.WriteHeader(c.statusCode)
+		if len(c.buffer) > 0 {
+			_, err = c.ResponseWriter.Write(c.buffer)
+		}
+	}
+	c.buffer = nil
+	return err
+}
+
+// Flush forces the compression decision and pushes pending data to the client, which keeps streaming responses working.
+func (c *compressionWriter) Flush() {
+	if !c.decided {
+		if c.statusCode == 0 {
+			c.statusCode = http.StatusOK
+		}
+		c.minimumSize = 0 // streaming is worth compressing
+		if err := c.decide(); err != nil {
+			return
+		}
+	}
+	if c.compressor != nil {
+		if err := c.compressor.Flush(); err != nil {
+			return
+		}
+	}
+	if flusher, ok := c.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to [http.ResponseController].
+func (c *compressionWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+func (c *compressionWriter) Close() (err error) {
+	if !c.decided {
+		if c.statusCode == 0 && len(c.buffer) == 0 {
+			return nil // nothing was written
+		}
+		if err = c.decide(); err != nil {
+			return err
+		}
+	}
+	if c.compressor == nil {
+		return nil
+	}
+	err = c.compressor.Close()
+	c.compressor.Reset(io.Discard)
+	c.pool.Put(c.compressor)
+	c.compressor = nil
+	return err
+}
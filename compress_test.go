@@ -0,0 +1,206 @@
+package oakmux
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dkotik/oakmux/adapt"
+)
+
+func TestNegotiateContentEncoding(t *testing.T) {
+	cases := map[string]string{
+		"":                          "",
+		"gzip":                      "gzip",
+		"deflate, gzip":             "gzip",
+		"gzip;q=0.5, deflate":       "deflate",
+		"gzip;q=0, deflate;q=0":     "",
+		"*":                         "gzip",
+		"br, *;q=0.1, gzip;q=0":     "deflate",
+		"identity":                  "",
+		"GZIP;q=0.8, deflate;q=0.7": "gzip",
+	}
+	for header, expected := range cases {
+		if encoding := NegotiateContentEncoding(header, "gzip", "deflate"); encoding != expected {
+			t.Errorf("Accept-Encoding %q negotiated %q instead of %q", header, encoding, expected)
+		}
+	}
+}
+
+func TestCompressionMiddleware(t *testing.T) {
+	large := strings.Repeat("compressible ", 200)
+	compression, err := NewCompressionMiddleware()
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := func(body, contentType string) Handler {
+		return HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+			if contentType != "" {
+				w.Header().Set("Content-Type", contentType)
+			}
+			io.WriteString(w, body)
+			return nil
+		})
+	}
+	mux, err := New(
+		WithMiddleware(compression),
+		WithRouteHandler("large", "/large", write(large, "")),
+		WithRouteHandler("small", "/small", write("small", "")),
+		WithRouteHandler("image", "/image", write(large, "image/png")),
+		WithRouteHandler("skipped", "/skipped", write(large, ""), SkipCompression),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, compressed := range map[string]bool{
+		"/large":   true,
+		"/small":   false,
+		"/image":   false,
+		"/skipped": false,
+	} {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		if err = mux.ServeHyperText(w, r); err != nil {
+			t.Fatal(err)
+		}
+		if w.Header().Get("Vary") != "Accept-Encoding" {
+			t.Fatalf("%s: Vary header is missing", path)
+		}
+		if (w.Header().Get("Content-Encoding") == "gzip") != compressed {
+			t.Fatalf("%s: unexpected Content-Encoding %q", path, w.Header().Get("Content-Encoding"))
+		}
+		if !compressed {
+			continue
+		}
+		reader, err := gzip.NewReader(w.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != large {
+			t.Fatalf("%s: decompressed body does not match", path)
+		}
+	}
+}
+
+func TestCompressionFlush(t *testing.T) {
+	compression, err := NewCompressionMiddleware()
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := compression(HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		io.WriteString(w, "first")
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			return err
+		}
+		io.WriteString(w, "second")
+		return nil
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "deflate")
+	w := httptest.NewRecorder()
+	if err = handler.ServeHyperText(w, r); err != nil {
+		t.Fatal(err)
+	}
+	if !w.Flushed || w.Header().Get("Content-Encoding") != "deflate" {
+		t.Fatal("streaming response was not flushed through the compressor")
+	}
+}
+
+func TestCompressionVary(t *testing.T) {
+	compression, err := NewCompressionMiddleware()
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := compression(HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		AddVary(w.Header(), "accept-encoding")
+		AddVary(w.Header(), "Accept")
+		_, err := io.WriteString(w, "small")
+		return err
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	if err = handler.ServeHyperText(w, r); err != nil {
+		t.Fatal(err)
+	}
+	if vary := w.Header().Values("Vary"); len(vary) != 2 || vary[0] != "Accept-Encoding" || vary[1] != "Accept" {
+		t.Fatalf("unexpected Vary header: %q", vary)
+	}
+}
+
+type compressedDocument struct {
+	Body string
+}
+
+func (d *compressedDocument) Validate() error {
+	if d.Body == "" {
+		return errors.New("body is required")
+	}
+	return nil
+}
+
+func TestCompressionETagPreconditions(t *testing.T) {
+	compression, err := NewCompressionMiddleware()
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := adapt.Version{Tag: "1"}
+	update, err := adapt.NewVersionedUnaryFuncAdaptor(
+		func(ctx context.Context, d *compressedDocument) (adapt.Version, error) {
+			current = adapt.Version{Tag: "2"}
+			return current, nil
+		},
+		adapt.NewJSONCodec[compressedDocument, *compressedDocument, adapt.Version](),
+		func(ctx context.Context, d *compressedDocument) (adapt.Version, error) {
+			return current, nil
+		},
+		adapt.PreconditionRequired,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := compression(HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		if r.Method == http.MethodPut {
+			return update.ServeHyperText(w, r)
+		}
+		w.Header().Set("ETag", `"`+current.Tag+`"`)
+		_, err := io.WriteString(w, strings.Repeat("compressible ", 200))
+		return err
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	if err = handler.ServeHyperText(w, r); err != nil {
+		t.Fatal(err)
+	}
+	tag := w.Header().Get("ETag")
+	if tag != `"1-gzip"` {
+		t.Fatalf("compressed response carries ETag %q", tag)
+	}
+
+	r = httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"Body":"updated"}`))
+	r.Header.Set("Accept-Encoding", "gzip")
+	r.Header.Set("If-Match", tag)
+	w = httptest.NewRecorder()
+	if err = handler.ServeHyperText(w, r); err != nil {
+		t.Fatal("If-Match with the compressed ETag failed:", err)
+	}
+	if r.Header.Get("If-Match") != tag {
+		t.Fatal("request header was modified in place")
+	}
+	if current.Tag != "2" {
+		t.Fatal("update was not applied")
+	}
+}
@@ -21,6 +21,24 @@ type RoutingContext struct {
 	matches []string
 }
 
+// Route returns the matched [Route].
+func (r *RoutingContext) Route() *Route {
+	return r.matched
+}
+
+// Tail returns the part of the request path matched by the terminal segment of the route with a leading slash. The trailing slash is preserved. The root route registered by [WithRouteFileSystem] reports "/". Returns false, if the route does not end with a terminal segment.
+func (r *RoutingContext) Tail() (string, bool) {
+	if r.matched.mountRoot {
+		return "/", true
+	}
+	for _, segment := range r.matched.segments {
+		if segment.Type() == SegmentTypeTerminal && len(r.matches) > 0 {
+			return "/" + r.matches[len(r.matches)-1], true
+		}
+	}
+	return "", false
+}
+
 func (r *RoutingContext) Path(routeName string, fields map[string]string) (string, error) {
 	route, ok := r.mux.routes[routeName]
 	if !ok {
@@ -44,20 +62,20 @@ func (r *RoutingContext) MatchedFields() *MatchedFields {
 		i++
 	}
 	return &MatchedFields{
-		route:    r.matched,
+		pattern:  r.matched,
 		bindings: bindings,
 	}
 }
 
 type MatchedFields struct {
-	route    *Route
+	pattern  fmt.Stringer
 	bindings map[string]string
 }
 
 func (m *MatchedFields) Str(name string, value *string) error {
 	fieldValue, ok := m.bindings[name]
 	if !ok {
-		return fmt.Errorf("route pattern %q does not contain field named %q", m.route, name)
+		return fmt.Errorf("pattern %q does not contain field named %q", m.pattern, name)
 	}
 	*value = fieldValue
 	return nil
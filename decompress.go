@@ -0,0 +1,183 @@
+package oakmux
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+const DefaultDecompressionRatioLimit = 100
+
+// RequestTooLargeError is returned when a request body exceeds the read limit after decompression or expands beyond the compression ratio limit.
+type RequestTooLargeError struct {
+	limit int64
+	ratio bool
+}
+
+// NewRequestTooLargeError reports a request body that exceeds the read limit.
+func NewRequestTooLargeError(limit int64) *RequestTooLargeError {
+	return &RequestTooLargeError{limit: limit}
+}
+
+func (e *RequestTooLargeError) Error() string {
+	return http.StatusText(http.StatusRequestEntityTooLarge)
+}
+
+func (e *RequestTooLargeError) HyperTextStatusCode() int {
+	return http.StatusRequestEntityTooLarge
+}
+
+func (e *RequestTooLargeError) LogValue() slog.Value {
+	if e.ratio {
+		return slog.GroupValue(
+			slog.String("message", "request body compression ratio exceeds the limit"),
+			slog.Int64("ratio", e.limit),
+		)
+	}
+	return slog.GroupValue(
+		slog.String("message", "decompressed request body exceeds the limit"),
+		slog.Int64("limit", e.limit),
+	)
+}
+
+type UnsupportedContentEncodingError struct {
+	encoding string
+}
+
+func (e *UnsupportedContentEncodingError) Error() string {
+	return "unsupported content encoding: " + e.encoding
+}
+
+func (e *UnsupportedContentEncodingError) HyperTextStatusCode() int {
+	return http.StatusUnsupportedMediaType
+}
+
+// RequestDecompressor transparently decompresses gzip and deflate request bodies. The decompressed body is held to the read limit and to the ratio between the decompressed and compressed sizes, which defeats decompression bombs.
+type RequestDecompressor struct {
+	readLimit  int64
+	ratioLimit int64
+	next       Handler
+}
+
+// NewRequestDecompressor creates a [RequestDecompressor]. A 0 read limit leaves the decompressed size bound only by the ratio.
+func NewRequestDecompressor(next Handler, readLimit int64, ratioLimit int) *RequestDecompressor {
+	if next == nil {
+		panic("cannot use a <nil> HTTP handler")
+	}
+	if readLimit < 0 {
+		panic("cannot use a negative read limit")
+	}
+	if ratioLimit <= 0 {
+		panic("compression ratio limit must be greater than 0")
+	}
+	return &RequestDecompressor{
+		readLimit:  readLimit,
+		ratioLimit: int64(ratioLimit),
+		next:       next,
+	}
+}
+
+func NewRequestDecompressorMiddleware(readLimit int64, ratioLimit int) Middleware {
+	return func(next Handler) Handler {
+		return NewRequestDecompressor(next, readLimit, ratioLimit)
+	}
+}
+
+func (d *RequestDecompressor) ServeHyperText(
+	w http.ResponseWriter,
+	r *http.Request,
+) (err error) {
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	if encoding == "" || encoding == "identity" || r.Body == nil || r.Body == http.NoBody {
+		return d.next.ServeHyperText(w, r)
+	}
+
+	compressed := &countingReader{Reader: r.Body}
+	var decompressor io.ReadCloser
+	switch encoding {
+	case "gzip", "x-gzip":
+		if decompressor, err = gzip.NewReader(compressed); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				return &RequestTooLargeError{limit: tooLarge.Limit}
+			}
+			return &UnsupportedContentEncodingError{encoding: encoding + ": " + err.Error()}
+		}
+	case "deflate":
+		decompressor = flate.NewReader(compressed)
+	default:
+		return &UnsupportedContentEncodingError{encoding: encoding}
+	}
+
+	original := r.Body
+	r.Body = &decompressingReader{
+		decompressor: decompressor,
+		original:     original,
+		compressed:   compressed,
+		readLimit:    d.readLimit,
+		ratioLimit:   d.ratioLimit,
+	}
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Content-Length")
+	r.ContentLength = -1
+	return d.next.ServeHyperText(w, r)
+}
+
+type countingReader struct {
+	io.Reader
+	count int64
+}
+
+func (c *countingReader) Read(p []byte) (n int, err error) {
+	n, err = c.Reader.Read(p)
+	c.count += int64(n)
+	return n, err
+}
+
+type decompressingReader struct {
+	decompressor io.ReadCloser
+	original     io.ReadCloser
+	compressed   *countingReader
+	readLimit    int64
+	ratioLimit   int64
+	count        int64
+	err          error
+}
+
+func (d *decompressingReader) Read(p []byte) (n int, err error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	if d.readLimit > 0 && int64(len(p)) > d.readLimit-d.count+1 {
+		p = p[:d.readLimit-d.count+1] // read one extra byte to detect overflow
+	}
+	n, err = d.decompressor.Read(p)
+	d.count += int64(n)
+	if d.readLimit > 0 && d.count > d.readLimit {
+		d.err = &RequestTooLargeError{limit: d.readLimit}
+		return 0, d.err
+	}
+	if d.count > d.ratioLimit*max(d.compressed.count, 1) {
+		d.err = &RequestTooLargeError{limit: d.ratioLimit, ratio: true}
+		return 0, d.err
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			err = &RequestTooLargeError{limit: tooLarge.Limit}
+		}
+		d.err = err
+	}
+	return n, err
+}
+
+func (d *decompressingReader) Close() error {
+	return errors.Join(d.decompressor.Close(), d.original.Close())
+}
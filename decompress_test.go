@@ -0,0 +1,60 @@
+package oakmux
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func gzipBody(t *testing.T, body string) *bytes.Buffer {
+	b := &bytes.Buffer{}
+	w := gzip.NewWriter(b)
+	if _, err := io.WriteString(w, body); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestRequestDecompression(t *testing.T) {
+	echo := HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(body)
+		return err
+	})
+	mux, err := New(
+		WithRequestReadLimitOf(1024),
+		WithRequestDecompression(20),
+		WithRouteHandler("echo", "/echo", echo),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(encoding string, body io.Reader) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/echo", body)
+		r.Header.Set("Content-Encoding", encoding)
+		return r
+	}
+
+	expectFromRequest(mux, request("gzip", gzipBody(t, `{"item":"shirt"}`)), http.StatusOK, `{"item":"shirt"}`)(t)
+	expectFromRequest(mux, request("", strings.NewReader("plain")), http.StatusOK, "plain")(t)
+	expectFromRequest(mux, request("br", strings.NewReader("plain")), http.StatusUnsupportedMediaType, "")(t)
+	expectFromRequest(mux, request("gzip", strings.NewReader("garbage")), http.StatusUnsupportedMediaType, "")(t)
+
+	random := make([]byte, 768)
+	_, _ = rand.New(rand.NewSource(1)).Read(random)
+	expectFromRequest(mux, request("gzip", gzipBody(t, hex.EncodeToString(random))), http.StatusRequestEntityTooLarge, "")(t)
+	expectFromRequest(mux, request("gzip", gzipBody(t, strings.Repeat("a", 1000))), http.StatusRequestEntityTooLarge, "")(t)
+}
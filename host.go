@@ -1,6 +1,7 @@
 package oakmux
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -10,31 +11,65 @@ import (
 
 type hostMuxOptions struct {
 	hosts    []string
+	patterns []*hostPattern
 	handlers []Handler
+	proxies  trustedProxies
+	fallback Handler
 }
 
 type HostMuxOption func(*hostMuxOptions) error
 
+// WithHostHandler routes requests for the host to the handler. The host can be a pattern with dynamic labels that match exactly one label each: "[tenant].example.com" captures the label as a field available from [GetHostContext], while "*.preview.example.com" matches without capturing. Static labels take precedence over dynamic ones. Patterns that match the same host names are rejected.
 func WithHostHandler(host string, handler Handler) HostMuxOption {
 	return func(o *hostMuxOptions) error {
-		if host == "" {
-			return errors.New("cannot use an empty host name")
+		pattern, err := newHostPattern(host)
+		if err != nil {
+			return err
 		}
 		if handler == nil {
 			return errors.New("cannot use a <nil> handler")
 		}
+		host = pattern.String() // normalized
 		for _, known := range o.hosts {
 			if known == host {
 				return fmt.Errorf("host %q already has a handler", known)
 			}
 		}
 		o.hosts = append(o.hosts, host)
+		o.patterns = append(o.patterns, pattern)
 		o.handlers = append(o.handlers, handler)
 		return nil
 	}
 }
 
-// NewHostMux creates a [Handler] that multiplexes by [http.Request] host name.
+// WithTrustedForwardedHost matches the X-Forwarded-Host header instead of the Host header for requests that arrive from the trusted reverse proxies, given as IP addresses or CIDR networks.
+func WithTrustedForwardedHost(proxies ...string) HostMuxOption {
+	return func(o *hostMuxOptions) (err error) {
+		if o.proxies != nil {
+			return errors.New("trusted proxies are already set")
+		}
+		if o.proxies, err = newTrustedProxies(proxies); err != nil {
+			return err
+		}
+		return nil
+	}
+}
+
+// WithDefaultHostHandler serves requests for unknown hosts instead of returning [UnknownHostError].
+func WithDefaultHostHandler(handler Handler) HostMuxOption {
+	return func(o *hostMuxOptions) error {
+		if handler == nil {
+			return errors.New("cannot use a <nil> default host handler")
+		}
+		if o.fallback != nil {
+			return errors.New("default host handler is already set")
+		}
+		o.fallback = handler
+		return nil
+	}
+}
+
+// NewHostMux creates a [Handler] that multiplexes by [http.Request] host name. Host names are compared without the port and the trailing dot, case-insensitively, and with internationalized labels in their punycode form.
 func NewHostMux(withOptions ...HostMuxOption) (Handler, error) {
 	var (
 		o   = &hostMuxOptions{}
@@ -54,6 +89,43 @@ func NewHostMux(withOptions ...HostMuxOption) (Handler, error) {
 		}
 	}
 
+	matcher, err := o.matcher()
+	if err != nil {
+		return nil, fmt.Errorf("cannot create a new host multiplexer: %w", err)
+	}
+	if o.proxies == nil && o.fallback == nil {
+		return matcher, nil
+	}
+	return &hostMux{
+		matcher:  matcher,
+		proxies:  o.proxies,
+		fallback: o.fallback,
+	}, nil
+}
+
+// hostMatcher finds the handler for a normalized host name.
+type hostMatcher interface {
+	Handler
+	MatchHost(name string) (Handler, *HostContext)
+}
+
+func (o *hostMuxOptions) matcher() (hostMatcher, error) {
+	for _, pattern := range o.patterns {
+		if pattern.IsStatic() {
+			continue
+		}
+		tree := &treeHostMux{root: &hostNode{}}
+		for i, pattern := range o.patterns {
+			if err := tree.root.Grow(&hostRoute{
+				pattern: pattern,
+				handler: o.handlers[i],
+			}, pattern.labels); err != nil {
+				return nil, err
+			}
+		}
+		return tree, nil
+	}
+
 	// mapHostMux will be faster than list at 8 entries
 	if len(o.hosts) >= 8 {
 		mux := make(mapHostMux)
@@ -68,6 +140,51 @@ func NewHostMux(withOptions ...HostMuxOption) (Handler, error) {
 	}, nil
 }
 
+// requestHost returns the normalized host name the request is addressed to. Server requests carry it in [http.Request.Host], while client requests may only have it in the URL.
+func requestHost(r *http.Request, proxies trustedProxies) string {
+	if forwarded := proxies.forwarded(r, "X-Forwarded-Host"); forwarded != "" {
+		return normalizeHost(forwarded)
+	}
+	if r.Host != "" {
+		return normalizeHost(r.Host)
+	}
+	return normalizeHost(r.URL.Host)
+}
+
+func serveHost(
+	w http.ResponseWriter,
+	r *http.Request,
+	matcher hostMatcher,
+	name string,
+	fallback Handler,
+) error {
+	handler, hostContext := matcher.MatchHost(name)
+	if handler == nil {
+		if fallback != nil {
+			return fallback.ServeHyperText(w, r)
+		}
+		return &UnknownHostError{host: name}
+	}
+	if hostContext != nil {
+		r = r.WithContext(context.WithValue(r.Context(), hostContextKey, hostContext))
+	}
+	return handler.ServeHyperText(w, r)
+}
+
+// hostMux adds forwarded host and default handler support to a [hostMatcher].
+type hostMux struct {
+	matcher  hostMatcher
+	proxies  trustedProxies
+	fallback Handler
+}
+
+func (h *hostMux) ServeHyperText(
+	w http.ResponseWriter,
+	r *http.Request,
+) error {
+	return serveHost(w, r, h.matcher, requestHost(r, h.proxies), h.fallback)
+}
+
 type UnknownHostError struct {
 	host string
 }
@@ -89,16 +206,15 @@ func (e *UnknownHostError) LogValue() slog.Value {
 
 type mapHostMux map[string]Handler
 
+func (h mapHostMux) MatchHost(name string) (Handler, *HostContext) {
+	return h[name], nil
+}
+
 func (h mapHostMux) ServeHyperText(
 	w http.ResponseWriter,
 	r *http.Request,
 ) error {
-	name := r.URL.Hostname()
-	handler, ok := h[name]
-	if !ok {
-		return &UnknownHostError{host: name}
-	}
-	return handler.ServeHyperText(w, r)
+	return serveHost(w, r, h, requestHost(r, nil), nil)
 }
 
 type listHostMux struct {
@@ -106,15 +222,18 @@ type listHostMux struct {
 	handlers []Handler
 }
 
-func (l *listHostMux) ServeHyperText(
-	w http.ResponseWriter,
-	r *http.Request,
-) error {
-	name := r.URL.Hostname()
+func (l *listHostMux) MatchHost(name string) (Handler, *HostContext) {
 	for i, host := range l.hosts {
 		if host == name {
-			return l.handlers[i].ServeHyperText(w, r)
+			return l.handlers[i], nil
 		}
 	}
-	return &UnknownHostError{host: name}
+	return nil, nil
+}
+
+func (l *listHostMux) ServeHyperText(
+	w http.ResponseWriter,
+	r *http.Request,
+) error {
+	return serveHost(w, r, l, requestHost(r, nil), nil)
 }
@@ -0,0 +1,223 @@
+package oakmux
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"unicode/utf8"
+)
+
+// normalizeHost strips the port and the trailing dot from the host, lowercases it, and converts internationalized labels to their ASCII punycode form, so that equivalent spellings of a host name compare equal.
+func normalizeHost(host string) string {
+	host = strings.TrimSpace(host)
+	if strings.HasPrefix(host, "[") { // IPv6 literal
+		if end := strings.IndexByte(host, ']'); end > 0 {
+			return strings.ToLower(host[1:end])
+		}
+		return ""
+	}
+	if colon := strings.LastIndexByte(host, ':'); colon >= 0 && strings.IndexByte(host, ':') == colon {
+		host = host[:colon]
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if isASCII(host) {
+		return host
+	}
+	labels := strings.Split(host, ".")
+	for i, label := range labels {
+		if !isASCII(label) {
+			labels[i] = "xn--" + encodePunycode(label)
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// Punycode parameters from RFC 3492.
+const (
+	punycodeBase        = 36
+	punycodeTMin        = 1
+	punycodeTMax        = 26
+	punycodeSkew        = 38
+	punycodeDamp        = 700
+	punycodeInitialBias = 72
+	punycodeInitialN    = 128
+)
+
+// encodePunycode encodes a Unicode label using the Bootstring algorithm of RFC 3492 without the "xn--" prefix.
+func encodePunycode(label string) string {
+	runes := []rune(label)
+	output := make([]byte, 0, len(label)+8)
+	for _, r := range runes {
+		if r < utf8.RuneSelf {
+			output = append(output, byte(r))
+		}
+	}
+	basic := len(output)
+	handled := basic
+	if basic > 0 {
+		output = append(output, '-')
+	}
+
+	n, delta, bias := rune(punycodeInitialN), 0, punycodeInitialBias
+	for handled < len(runes) {
+		next := rune(utf8.MaxRune)
+		for _, r := range runes {
+			if r >= n && r < next {
+				next = r
+			}
+		}
+		delta += int(next-n) * (handled + 1)
+		n = next
+		for _, r := range runes {
+			if r < n {
+				delta++
+			}
+			if r != n {
+				continue
+			}
+			q := delta
+			for k := punycodeBase; ; k += punycodeBase {
+				t := k - bias
+				if t < punycodeTMin {
+					t = punycodeTMin
+				} else if t > punycodeTMax {
+					t = punycodeTMax
+				}
+				if q < t {
+					break
+				}
+				output = append(output, punycodeDigit(t+(q-t)%(punycodeBase-t)))
+				q = (q - t) / (punycodeBase - t)
+			}
+			output = append(output, punycodeDigit(q))
+			bias = adaptPunycodeBias(delta, handled+1, handled == basic)
+			delta = 0
+			handled++
+		}
+		delta++
+		n++
+	}
+	return string(output)
+}
+
+func punycodeDigit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
+
+func adaptPunycodeBias(delta, points int, first bool) int {
+	if first {
+		delta /= punycodeDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / points
+	k := 0
+	for delta > ((punycodeBase-punycodeTMin)*punycodeTMax)/2 {
+		delta /= punycodeBase - punycodeTMin
+		k += punycodeBase
+	}
+	return k + (punycodeBase-punycodeTMin+1)*delta/(delta+punycodeSkew)
+}
+
+// trustedProxies are the networks of reverse proxies whose forwarding headers are believed.
+type trustedProxies []netip.Prefix
+
+// newTrustedProxies parses IP addresses and CIDR network prefixes.
+func newTrustedProxies(proxies []string) (trustedProxies, error) {
+	if len(proxies) == 0 {
+		return nil, fmt.Errorf("empty trusted proxy list")
+	}
+	result := make(trustedProxies, 0, len(proxies))
+	for _, proxy := range proxies {
+		if strings.Contains(proxy, "/") {
+			prefix, err := netip.ParsePrefix(proxy)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy network %q: %w", proxy, err)
+			}
+			result = append(result, prefix.Masked())
+			continue
+		}
+		address, err := netip.ParseAddr(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy address %q: %w", proxy, err)
+		}
+		result = append(result, netip.PrefixFrom(address, address.BitLen()))
+	}
+	return result, nil
+}
+
+// Trusts reports whether the request arrived directly from a trusted proxy.
+func (t trustedProxies) Trusts(r *http.Request) bool {
+	if len(t) == 0 {
+		return false
+	}
+	address, err := netip.ParseAddr(remoteHost(r))
+	if err != nil {
+		return false
+	}
+	return t.contains(address)
+}
+
+func (t trustedProxies) contains(address netip.Addr) bool {
+	address = address.Unmap()
+	for _, prefix := range t {
+		if prefix.Contains(address) {
+			return true
+		}
+	}
+	return false
+}
+
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr // no port
+	}
+	return host
+}
+
+// ClientAddress returns the address of the client. For requests from a trusted proxy, it is the right-most X-Forwarded-For address that does not belong to a trusted proxy.
+func (t trustedProxies) ClientAddress(r *http.Request) string {
+	client := remoteHost(r)
+	if !t.Trusts(r) {
+		return client
+	}
+	var hops []string
+	for _, value := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		address, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			return client // malformed hop, the last known address is the best guess
+		}
+		client = address.Unmap().String()
+		if !t.contains(address) {
+			return client
+		}
+	}
+	return client
+}
+
+// forwarded returns the first value of the forwarding header, if the request came from a trusted proxy.
+func (t trustedProxies) forwarded(r *http.Request, header string) string {
+	if !t.Trusts(r) {
+		return ""
+	}
+	value, _, _ := strings.Cut(r.Header.Get(header), ",")
+	return strings.TrimSpace(value)
+}
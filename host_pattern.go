@@ -0,0 +1,215 @@
+package oakmux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type hostLabelType uint8
+
+const (
+	hostLabelStatic hostLabelType = iota
+	hostLabelDynamic
+	hostLabelWildcard
+)
+
+type hostLabel struct {
+	value string // static label or field name
+	kind  hostLabelType
+}
+
+// hostPattern is a host name where labels can be captured like "[tenant].example.com" or matched without capturing like "*.preview.example.com". Each dynamic label matches exactly one label of the host name.
+type hostPattern struct {
+	labels []hostLabel
+}
+
+func newHostPattern(definition string) (*hostPattern, error) {
+	if definition == "" {
+		return nil, errors.New("cannot use an empty host name")
+	}
+	p := &hostPattern{}
+	names := make(map[string]struct{})
+	for _, label := range strings.Split(strings.TrimSuffix(strings.ToLower(definition), "."), ".") {
+		switch {
+		case label == "":
+			return nil, fmt.Errorf("host pattern %q contains an empty label", definition)
+		case label == "*":
+			p.labels = append(p.labels, hostLabel{kind: hostLabelWildcard})
+		case strings.HasPrefix(label, "[") && strings.HasSuffix(label, "]"):
+			name := label[1 : len(label)-1]
+			if name == "" || strings.ContainsAny(name, "[]*") {
+				return nil, fmt.Errorf("host pattern %q contains an invalid field name %q", definition, name)
+			}
+			if _, ok := names[name]; ok {
+				return nil, fmt.Errorf("host pattern field %q occurs twice", name)
+			}
+			names[name] = struct{}{}
+			p.labels = append(p.labels, hostLabel{value: name, kind: hostLabelDynamic})
+		case strings.ContainsAny(label, "[]*"):
+			return nil, fmt.Errorf("host pattern %q contains an invalid label %q", definition, label)
+		case !isASCII(label):
+			p.labels = append(p.labels, hostLabel{value: "xn--" + encodePunycode(label)})
+		default:
+			p.labels = append(p.labels, hostLabel{value: label})
+		}
+	}
+	return p, nil
+}
+
+// IsStatic reports whether the pattern matches only one host name.
+func (p *hostPattern) IsStatic() bool {
+	for _, label := range p.labels {
+		if label.kind != hostLabelStatic {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *hostPattern) String() string {
+	b := strings.Builder{}
+	for i, label := range p.labels {
+		if i > 0 {
+			_ = b.WriteByte('.')
+		}
+		switch label.kind {
+		case hostLabelDynamic:
+			_, _ = b.WriteString("[" + label.value + "]")
+		case hostLabelWildcard:
+			_ = b.WriteByte('*')
+		default:
+			_, _ = b.WriteString(label.value)
+		}
+	}
+	return b.String()
+}
+
+type hostRoute struct {
+	pattern *hostPattern
+	handler Handler
+}
+
+// hostNode is the routing tree component for host names. Labels are matched from right to left, so that the top level domain is the root of the tree. Static labels take precedence over dynamic ones.
+type hostNode struct {
+	static  map[string]*hostNode
+	dynamic *hostNode
+	leaf    *hostRoute
+}
+
+func (n *hostNode) Grow(route *hostRoute, remaining []hostLabel) error {
+	if len(remaining) == 0 {
+		if n.leaf != nil {
+			return fmt.Errorf("host patterns %q and %q overlap", n.leaf.pattern, route.pattern)
+		}
+		n.leaf = route
+		return nil
+	}
+	current := remaining[len(remaining)-1]
+	remaining = remaining[:len(remaining)-1]
+	if current.kind != hostLabelStatic {
+		if n.dynamic == nil {
+			n.dynamic = &hostNode{}
+		}
+		return n.dynamic.Grow(route, remaining)
+	}
+	if n.static == nil {
+		n.static = make(map[string]*hostNode)
+	}
+	branch, ok := n.static[current.value]
+	if !ok {
+		branch = &hostNode{}
+		n.static[current.value] = branch
+	}
+	return branch.Grow(route, remaining)
+}
+
+// Match finds the route for the host name labels. The captured values of dynamic labels are returned in the order of the pattern.
+func (n *hostNode) Match(labels []string) (*hostRoute, []string) {
+	if len(labels) == 0 {
+		return n.leaf, nil
+	}
+	current := labels[len(labels)-1]
+	remaining := labels[:len(labels)-1]
+	if branch, ok := n.static[current]; ok {
+		if route, captured := branch.Match(remaining); route != nil {
+			return route, captured
+		}
+	}
+	if n.dynamic != nil {
+		if route, captured := n.dynamic.Match(remaining); route != nil {
+			return route, append(captured, current)
+		}
+	}
+	return nil, nil
+}
+
+type treeHostMux struct {
+	root *hostNode
+}
+
+func (t *treeHostMux) MatchHost(name string) (Handler, *HostContext) {
+	route, captured := t.root.Match(strings.Split(name, "."))
+	if route == nil {
+		return nil, nil
+	}
+	return route.handler, &HostContext{
+		host:     name,
+		pattern:  route.pattern,
+		captured: captured,
+	}
+}
+
+func (t *treeHostMux) ServeHyperText(
+	w http.ResponseWriter,
+	r *http.Request,
+) error {
+	return serveHost(w, r, t, requestHost(r, nil), nil)
+}
+
+type hostContextKeyType struct{}
+
+var hostContextKey = &hostContextKeyType{}
+
+// GetHostContext returns the host matching state of a host multiplexer with at least one dynamic pattern. Returns <nil> otherwise.
+func GetHostContext(ctx context.Context) *HostContext {
+	host, _ := ctx.Value(hostContextKey).(*HostContext)
+	return host
+}
+
+type HostContext struct {
+	host     string
+	pattern  *hostPattern
+	captured []string
+}
+
+// Host returns the matched host name.
+func (h *HostContext) Host() string {
+	return h.host
+}
+
+// Pattern returns the matched host pattern.
+func (h *HostContext) Pattern() string {
+	return h.pattern.String()
+}
+
+// MatchedFields returns the labels captured by the named dynamic labels of the host pattern, like "tenant" in "[tenant].example.com".
+func (h *HostContext) MatchedFields() *MatchedFields {
+	bindings := make(map[string]string)
+	i := 0
+	for _, label := range h.pattern.labels {
+		if label.kind == hostLabelStatic {
+			continue
+		}
+		if label.kind == hostLabelDynamic {
+			bindings[label.value] = h.captured[i]
+		}
+		i++
+	}
+	return &MatchedFields{
+		pattern:  h.pattern,
+		bindings: bindings,
+	}
+}
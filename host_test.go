@@ -3,7 +3,9 @@ package oakmux
 import (
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 var testHostHandler = HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
@@ -44,3 +46,231 @@ func TestHostMuxCreation(t *testing.T) {
 		t.Fatal("created mux is not a mapHostMux")
 	}
 }
+
+func TestHostMuxPatterns(t *testing.T) {
+	labels := HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		var tenant, region string
+		fields := GetHostContext(r.Context()).MatchedFields()
+		if err := fields.Str("tenant", &tenant); err != nil {
+			return err
+		}
+		_ = fields.Str("region", &region)
+		_, err := io.WriteString(w, tenant+"@"+region)
+		return err
+	})
+	preview := HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		_, err := io.WriteString(w, "preview of "+GetHostContext(r.Context()).Host())
+		return err
+	})
+	mux, err := NewHostMux(
+		WithHostHandler("www.example.com", testHostHandler),
+		WithHostHandler("[tenant].example.com", labels),
+		WithHostHandler("[tenant].[region].example.com", labels),
+		WithHostHandler("*.preview.example.com", preview),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for host, expected := range map[string]string{
+		"www.example.com":           "Hello world!",
+		"acme.example.com":          "acme@",
+		"acme.eu.example.com":       "acme@eu",
+		"pr-12.preview.example.com": "preview of pr-12.preview.example.com",
+	} {
+		t.Run(host, expectFromRequest(mux, httptest.NewRequest(http.MethodGet, "http://"+host+"/", nil), http.StatusOK, expected))
+	}
+	t.Run("unknown", expectFromRequest(mux, httptest.NewRequest(http.MethodGet, "http://example.com/", nil), http.StatusNotFound, ""))
+	t.Run("too deep", expectFromRequest(mux, httptest.NewRequest(http.MethodGet, "http://a.b.c.example.com/", nil), http.StatusNotFound, ""))
+
+	for _, overlapping := range [][2]string{
+		{"[tenant].example.com", "*.example.com"},
+		{"[a].[b].example.com", "*.[c].example.com"},
+	} {
+		if _, err = NewHostMux(
+			WithHostHandler(overlapping[0], testHostHandler),
+			WithHostHandler(overlapping[1], testHostHandler),
+		); err == nil {
+			t.Fatalf("overlapping host patterns %q and %q were accepted", overlapping[0], overlapping[1])
+		}
+	}
+	for _, invalid := range []string{"[].example.com", "a..com", "[x].[x].com", "w*w.example.com"} {
+		if _, err = NewHostMux(WithHostHandler(invalid, testHostHandler)); err == nil {
+			t.Fatalf("invalid host pattern %q was accepted", invalid)
+		}
+	}
+}
+
+func TestHostNormalization(t *testing.T) {
+	for host, expected := range map[string]string{
+		"Example.COM":               "example.com",
+		"example.com.":              "example.com",
+		"example.com:8080":          "example.com",
+		"[::1]:8080":                "::1",
+		"bücher.example":            "xn--bcher-kva.example",
+		"MÜNCHEN.de.":               "xn--mnchen-3ya.de",
+		"правительство.рф":          "xn--80aealotwbjpid2k.xn--p1ai",
+		"xn--bcher-kva.example:443": "xn--bcher-kva.example",
+	} {
+		if normalized := normalizeHost(host); normalized != expected {
+			t.Errorf("host %q was normalized to %q instead of %q", host, normalized, expected)
+		}
+	}
+}
+
+func TestHostMuxRequestHost(t *testing.T) {
+	fallback := HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		_, err := io.WriteString(w, "fallback")
+		return err
+	})
+	mux, err := NewHostMux(
+		WithHostHandler("example.com", testHostHandler),
+		WithHostHandler("Bücher.example", testHostHandler),
+		WithTrustedForwardedHost("10.0.0.0/8", "192.0.2.1"),
+		WithDefaultHostHandler(fallback),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverRequest := func(host, remote, forwarded string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.URL.Host = "" // as parsed by the server
+		r.Host = host
+		r.RemoteAddr = remote
+		if forwarded != "" {
+			r.Header.Set("X-Forwarded-Host", forwarded)
+		}
+		return r
+	}
+	for name, testCase := range map[string]struct {
+		request  *http.Request
+		expected string
+	}{
+		"port":                {serverRequest("EXAMPLE.com:8080", "203.0.113.5:1234", ""), "Hello world!"},
+		"trailing dot":        {serverRequest("example.com.", "203.0.113.5:1234", ""), "Hello world!"},
+		"punycode":            {serverRequest("xn--bcher-kva.example", "203.0.113.5:1234", ""), "Hello world!"},
+		"unknown":             {serverRequest("other.com", "203.0.113.5:1234", ""), "fallback"},
+		"trusted forwarded":   {serverRequest("internal", "10.1.2.3:1234", "example.com, proxy.internal"), "Hello world!"},
+		"trusted address":     {serverRequest("internal", "192.0.2.1:1234", "example.com"), "Hello world!"},
+		"untrusted forwarded": {serverRequest("other.com", "203.0.113.5:1234", "example.com"), "fallback"},
+	} {
+		t.Run(name, expectFromRequest(mux, testCase.request, http.StatusOK, testCase.expected))
+	}
+
+	strict, err := NewHostMux(WithHostHandler("example.com", testHostHandler))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Run("without default", expectFromRequest(strict, serverRequest("other.com", "203.0.113.5:1234", ""), http.StatusNotFound, ""))
+	t.Run("server request", expectFromRequest(strict, serverRequest("example.com:443", "203.0.113.5:1234", ""), http.StatusOK, "Hello world!"))
+}
+
+func TestCanonicalRedirect(t *testing.T) {
+	fallback, err := NewCanonicalRedirect(
+		WithCanonicalHost("example.com"),
+		WithHTTPS(),
+		WithTrustedForwardedProto("10.0.0.0/8"),
+		WithStrictTransportSecurity(time.Hour*24*365, true, false),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enforce, err := NewCanonicalMiddleware(
+		WithCanonicalHost("example.com"),
+		WithHTTPS(),
+		WithTrustedForwardedProto("10.0.0.0/8"),
+		WithStrictTransportSecurity(time.Hour*24*365, true, false),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux, err := NewHostMux(
+		WithHostHandler("example.com", enforce(testHostHandler)),
+		WithDefaultHostHandler(fallback),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		URL        string
+		RemoteAddr string
+		Proto      string
+		Location   string
+		HSTS       bool
+	}{
+		{URL: "http://www.example.com/a?b=c", Location: "https://example.com/a?b=c"},
+		{URL: "http://example.com:80/a%20b", Location: "https://example.com/a%20b"},
+		{URL: "http://www.example.com:8080/x", Location: "https://example.com/x"},
+		{URL: "https://example.com:443/", HSTS: true},
+		{URL: "http://example.com/", RemoteAddr: "10.0.0.1:1234", Proto: "https", HSTS: true},
+		{URL: "http://example.com/", RemoteAddr: "192.0.2.1:1234", Proto: "https", Location: "https://example.com/"},
+		{URL: "https://www.example.com/x", Location: "https://example.com/x", HSTS: true},
+		{URL: "https://example.com/", HSTS: true},
+	}
+	for _, c := range cases {
+		t.Run(c.URL, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, c.URL, nil)
+			if c.RemoteAddr != "" {
+				r.RemoteAddr = c.RemoteAddr
+			}
+			if c.Proto != "" {
+				r.Header.Set("X-Forwarded-Proto", c.Proto)
+			}
+			w := httptest.NewRecorder()
+			if err := mux.ServeHyperText(w, r); err != nil {
+				t.Fatal(err)
+			}
+			if c.Location == "" {
+				if w.Code != http.StatusOK {
+					t.Fatalf("unexpected status code %d", w.Code)
+				}
+			} else {
+				if w.Code != http.StatusPermanentRedirect {
+					t.Fatalf("unexpected status code %d", w.Code)
+				}
+				if location := w.Header().Get("Location"); location != c.Location {
+					t.Fatalf("redirected to %q instead of %q", location, c.Location)
+				}
+			}
+			hsts := w.Header().Get("Strict-Transport-Security")
+			if c.HSTS && hsts != "max-age=31536000; includeSubDomains" {
+				t.Fatalf("unexpected Strict-Transport-Security header %q", hsts)
+			} else if !c.HSTS && hsts != "" {
+				t.Fatalf("Strict-Transport-Security header %q sent over plain HTTP", hsts)
+			}
+		})
+	}
+
+	pinned, err := NewCanonicalRedirect(WithCanonicalHost("example.com:8443"), WithHTTPS())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	if err = pinned.ServeHyperText(w, httptest.NewRequest(http.MethodGet, "http://www.example.com:8080/x", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if location := w.Header().Get("Location"); location != "https://example.com:8443/x" {
+		t.Fatalf("redirected to %q instead of the canonical port", location)
+	}
+
+	ported, err := NewCanonicalRedirect(WithHTTPS(), WithCanonicalPort("8443"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	if err = ported.ServeHyperText(w, httptest.NewRequest(http.MethodGet, "http://example.com:8080/x", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if location := w.Header().Get("Location"); location != "https://example.com:8443/x" {
+		t.Fatalf("redirected to %q instead of the canonical port", location)
+	}
+	if _, err = NewCanonicalRedirect(WithCanonicalHost("example.com:8443"), WithCanonicalPort("443")); err == nil {
+		t.Fatal("conflicting canonical ports were accepted")
+	}
+
+	if _, err = NewCanonicalRedirect(); err == nil {
+		t.Fatal("canonical redirect without a host or HTTPS was accepted")
+	}
+}
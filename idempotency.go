@@ -0,0 +1,272 @@
+package oakmux
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	IdempotencyKeyHeader         = "Idempotency-Key"
+	DefaultIdempotencyExpiration = time.Hour * 24
+	maximumIdempotencyKeyLength  = 255
+)
+
+var (
+	ErrIdempotencyKeyInvalid    Error = &idempotencyError{message: "invalid idempotency key", statusCode: http.StatusBadRequest}
+	ErrIdempotencyKeyInProgress Error = &idempotencyError{message: "request with the same idempotency key is in progress", statusCode: http.StatusConflict}
+	ErrIdempotencyKeyReused     Error = &idempotencyError{message: "idempotency key was used for a different request", statusCode: http.StatusUnprocessableEntity}
+)
+
+type idempotencyError struct {
+	message    string
+	statusCode int
+}
+
+func (e *idempotencyError) Error() string {
+	return e.message
+}
+
+func (e *idempotencyError) HyperTextStatusCode() int {
+	return e.statusCode
+}
+
+// IdempotencyStore persists responses to requests carrying an [IdempotencyKeyHeader].
+type IdempotencyStore interface {
+	// Acquire reserves the key for a request with the given fingerprint. It returns the stored response, if the request with the same key was already completed, [ErrIdempotencyKeyInProgress], if it is still running, or [ErrIdempotencyKeyReused], if the fingerprints do not match.
+	Acquire(ctx context.Context, key, fingerprint string) (*CapturedResponse, error)
+	// Complete stores the response for an acquired key.
+	Complete(ctx context.Context, key string, response *CapturedResponse) error
+	// Release frees an acquired key without storing a response, so that the request can be retried.
+	Release(ctx context.Context, key string) error
+}
+
+type idempotencyRecord struct {
+	fingerprint string
+	response    *CapturedResponse
+	expires     time.Time
+}
+
+type memoryIdempotencyStore struct {
+	mu         sync.Mutex
+	expiration time.Duration
+	records    map[string]*idempotencyRecord
+	nextSweep  time.Time
+}
+
+// NewIdempotencyMemoryStore creates an [IdempotencyStore] that keeps completed responses in memory until expiration.
+func NewIdempotencyMemoryStore(expiration time.Duration) IdempotencyStore {
+	if expiration <= 0 {
+		panic("idempotency record expiration must be greater than 0")
+	}
+	return &memoryIdempotencyStore{
+		expiration: expiration,
+		records:    make(map[string]*idempotencyRecord),
+		nextSweep:  time.Now().Add(expiration),
+	}
+}
+
+func (s *memoryIdempotencyStore) sweep(now time.Time) {
+	if now.Before(s.nextSweep) {
+		return
+	}
+	for key, record := range s.records {
+		if record.response != nil && now.After(record.expires) {
+			delete(s.records, key)
+		}
+	}
+	s.nextSweep = now.Add(s.expiration)
+}
+
+func (s *memoryIdempotencyStore) Acquire(
+	ctx context.Context,
+	key, fingerprint string,
+) (*CapturedResponse, error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+
+	record, ok := s.records[key]
+	if ok && record.response != nil && now.After(record.expires) {
+		ok = false // expired
+	}
+	if !ok {
+		s.records[key] = &idempotencyRecord{fingerprint: fingerprint}
+		return nil, nil
+	}
+	if record.fingerprint != fingerprint {
+		return nil, ErrIdempotencyKeyReused
+	}
+	if record.response == nil {
+		return nil, ErrIdempotencyKeyInProgress
+	}
+	return record.response, nil
+}
+
+func (s *memoryIdempotencyStore) Complete(
+	ctx context.Context,
+	key string,
+	response *CapturedResponse,
+) error {
+	if response == nil {
+		return errors.New("cannot store a <nil> response")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.records[key]
+	if !ok {
+		return fmt.Errorf("idempotency key %q was not acquired", key)
+	}
+	record.response = response
+	record.expires = time.Now().Add(s.expiration)
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+type idempotencyOptions struct {
+	store         IdempotencyStore
+	responseLimit int
+}
+
+type IdempotencyOption func(*idempotencyOptions) error
+
+func WithIdempotencyStore(s IdempotencyStore) IdempotencyOption {
+	return func(o *idempotencyOptions) error {
+		if s == nil {
+			return errors.New("cannot use a <nil> idempotency store")
+		}
+		if o.store != nil {
+			return errors.New("idempotency store is already set")
+		}
+		o.store = s
+		return nil
+	}
+}
+
+// WithIdempotencyResponseLimitOf caps the size of stored response bodies. Responses that exceed the limit are not stored and their keys are released.
+func WithIdempotencyResponseLimitOf(maximumBytes int) IdempotencyOption {
+	return func(o *idempotencyOptions) error {
+		if maximumBytes <= 0 {
+			return errors.New("response limit must be greater than 0 bytes")
+		}
+		if o.responseLimit != 0 {
+			return fmt.Errorf("response limit is already set to: %d", o.responseLimit)
+		}
+		o.responseLimit = maximumBytes
+		return nil
+	}
+}
+
+// NewIdempotencyMiddleware creates a [Middleware] that replays stored responses for repeated unsafe requests carrying the same [IdempotencyKeyHeader]. Requests without the header and safe methods pass through.
+func NewIdempotencyMiddleware(withOptions ...IdempotencyOption) (Middleware, error) {
+	o := &idempotencyOptions{}
+	for _, option := range append(
+		withOptions,
+		func(o *idempotencyOptions) error {
+			if o.store == nil {
+				o.store = NewIdempotencyMemoryStore(DefaultIdempotencyExpiration)
+			}
+			if o.responseLimit == 0 {
+				o.responseLimit = DefaultRequestReadLimitOf1MB
+			}
+			return nil
+		},
+	) {
+		if err := option(o); err != nil {
+			return nil, fmt.Errorf("cannot create idempotency middleware: %w", err)
+		}
+	}
+
+	return func(next Handler) Handler {
+		return &idempotencyHandler{
+			next:          next,
+			store:         o.store,
+			responseLimit: o.responseLimit,
+		}
+	}, nil
+}
+
+type idempotencyHandler struct {
+	next          Handler
+	store         IdempotencyStore
+	responseLimit int
+}
+
+func (h *idempotencyHandler) ServeHyperText(
+	w http.ResponseWriter,
+	r *http.Request,
+) (err error) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return h.next.ServeHyperText(w, r)
+	}
+	key := r.Header.Get(IdempotencyKeyHeader)
+	if key == "" {
+		return h.next.ServeHyperText(w, r)
+	}
+	if len(key) > maximumIdempotencyKeyLength {
+		return ErrIdempotencyKeyInvalid
+	}
+	if routing := GetRoutingContext(r.Context()); routing != nil {
+		key = routing.Route().Name() + ":" + key
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return fmt.Errorf("unable to read request body: %w", err)
+	}
+	_ = r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	hash := sha256.New()
+	_, _ = io.WriteString(hash, r.Method)
+	_, _ = io.WriteString(hash, " ")
+	_, _ = io.WriteString(hash, r.URL.RequestURI())
+	_, _ = io.WriteString(hash, "\n")
+	_, _ = hash.Write(body)
+	fingerprint := hex.EncodeToString(hash.Sum(nil))
+
+	ctx := r.Context()
+	stored, err := h.store.Acquire(ctx, key, fingerprint)
+	if err != nil {
+		return err
+	}
+	if stored != nil {
+		return stored.ServeHyperText(w, r)
+	}
+
+	completed := false
+	defer func() {
+		if !completed {
+			err = errors.Join(err, h.store.Release(ctx, key))
+		}
+	}()
+
+	capture := newResponseCapture(w, h.responseLimit)
+	if err = h.next.ServeHyperText(capture, r); err != nil {
+		return err
+	}
+	response := capture.Response()
+	if response == nil {
+		return nil // too large to store
+	}
+	if err = h.store.Complete(ctx, key, response); err != nil {
+		return fmt.Errorf("unable to store idempotent response: %w", err)
+	}
+	completed = true
+	return nil
+}
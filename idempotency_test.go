@@ -0,0 +1,66 @@
+package oakmux
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	calls := 0
+	middleware, err := NewIdempotencyMiddleware()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux, err := New(
+		WithRouteHandler("order", "/order", HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) error {
+				calls++
+				body, _ := io.ReadAll(r.Body)
+				fmt.Fprintf(w, "%d:%s", calls, body)
+				return nil
+			},
+		), middleware),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(key, body string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/order", strings.NewReader(body))
+		if key != "" {
+			r.Header.Set(IdempotencyKeyHeader, key)
+		}
+		return r
+	}
+
+	expectFromRequest(mux, request("first", "shirt"), http.StatusOK, "1:shirt")(t)
+	expectFromRequest(mux, request("first", "shirt"), http.StatusOK, "1:shirt")(t)
+	expectFromRequest(mux, request("first", "pants"), http.StatusUnprocessableEntity, "")(t)
+	expectFromRequest(mux, request("", "shirt"), http.StatusOK, "2:shirt")(t)
+	expectFromRequest(mux, request("second", "shirt"), http.StatusOK, "3:shirt")(t)
+	if calls != 3 {
+		t.Fatalf("domain call was performed %d times instead of 3", calls)
+	}
+}
+
+func TestIdempotencyMemoryStoreInProgress(t *testing.T) {
+	store := NewIdempotencyMemoryStore(DefaultIdempotencyExpiration)
+	ctx := context.Background()
+	if _, err := store.Acquire(ctx, "key", "fingerprint"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Acquire(ctx, "key", "fingerprint"); err != ErrIdempotencyKeyInProgress {
+		t.Fatal("expected a conflict for a concurrent duplicate, got:", err)
+	}
+	if err := store.Release(ctx, "key"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Acquire(ctx, "key", "fingerprint"); err != nil {
+		t.Fatal("released key could not be acquired again:", err)
+	}
+}
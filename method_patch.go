@@ -56,6 +56,48 @@ func WithPatchCustomFunc[T any, V adapt.Validatable[T], O any](
 	}
 }
 
+// WithPatchVersionedFunc adapts a mutation that is guarded by If-Match and If-Unmodified-Since preconditions against the current resource version. See [adapt.NewVersionedUnaryFuncAdaptor].
+func WithPatchVersionedFunc[T any, V adapt.Validatable[T], O any](
+	domainCall func(context.Context, V) (O, error),
+	version adapt.VersionFunc[T, V],
+	policy adapt.PreconditionPolicy,
+	mws ...Middleware,
+) MethodMuxOption {
+	return func(o *methodMuxOptions) (err error) {
+		adapted, err := adapt.NewVersionedUnaryFuncAdaptor(
+			domainCall,
+			adapt.NewJSONCodec[T, V, O](),
+			version,
+			policy,
+		)
+		if err != nil {
+			return fmt.Errorf("cannot adapt domain call for PATCH method: %w", err)
+		}
+		return WithPatchHandler(adapted, mws...)(o)
+	}
+}
+
+// WithPatchPartialFunc adapts a partial update. The request body is applied as a merge patch or a JSON patch onto the current resource provided by the loader. See [adapt.NewJSONPatchCodec].
+func WithPatchPartialFunc[T any, V adapt.Validatable[T], O any](
+	domainCall func(context.Context, V) (O, error),
+	load adapt.Loader[T, V],
+	mws ...Middleware,
+) MethodMuxOption {
+	return func(o *methodMuxOptions) (err error) {
+		if load == nil {
+			return errors.New("cannot use a <nil> resource loader")
+		}
+		adapted, err := adapt.NewUnaryFuncAdaptor(
+			domainCall,
+			adapt.NewJSONPatchCodec[T, V, O](load),
+		)
+		if err != nil {
+			return fmt.Errorf("cannot adapt domain call for PATCH method: %w", err)
+		}
+		return WithPatchHandler(adapted, mws...)(o)
+	}
+}
+
 func WithPatchNullaryFunc[O any](
 	domainCall func(context.Context) (O, error),
 	mws ...Middleware,
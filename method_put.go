@@ -56,6 +56,27 @@ func WithPutCustomFunc[T any, V adapt.Validatable[T], O any](
 	}
 }
 
+// WithPutVersionedFunc adapts a mutation that is guarded by If-Match and If-Unmodified-Since preconditions against the current resource version. See [adapt.NewVersionedUnaryFuncAdaptor].
+func WithPutVersionedFunc[T any, V adapt.Validatable[T], O any](
+	domainCall func(context.Context, V) (O, error),
+	version adapt.VersionFunc[T, V],
+	policy adapt.PreconditionPolicy,
+	mws ...Middleware,
+) MethodMuxOption {
+	return func(o *methodMuxOptions) (err error) {
+		adapted, err := adapt.NewVersionedUnaryFuncAdaptor(
+			domainCall,
+			adapt.NewJSONCodec[T, V, O](),
+			version,
+			policy,
+		)
+		if err != nil {
+			return fmt.Errorf("cannot adapt domain call for PUT method: %w", err)
+		}
+		return WithPutHandler(adapted, mws...)(o)
+	}
+}
+
 func WithPutNullaryFunc[O any](
 	domainCall func(context.Context) (O, error),
 	mws ...Middleware,
@@ -63,6 +63,15 @@ func New(withOptions ...Option) (Handler, error) {
 		withOptions,
 		WithDefaultRequestReadLimitOf1MB(),
 		func(o *options) error {
+			if o.decompressionRatioLimit != 0 { // inject decompression middleware
+				readLimit := o.maximumRequestBytes
+				if o.limitlessRequestBytes {
+					readLimit = 0
+				}
+				o.middleware = append([]Middleware{
+					NewRequestDecompressorMiddleware(readLimit, o.decompressionRatioLimit),
+				}, o.middleware...)
+			}
 			if o.limitlessRequestBytes {
 				return nil
 			}
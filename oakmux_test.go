@@ -66,3 +66,23 @@ func TestMux(t *testing.T) {
 		httptest.NewRequest(http.MethodPost, "/test/1/2/last/", nil),
 		http.StatusOK, "/test/1/2/last/")(t)
 }
+
+func TestRouteFileSystemTail(t *testing.T) {
+	tails := HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		tail, ok := GetRoutingContext(r.Context()).Tail()
+		if !ok {
+			return errors.New("route has no terminal segment")
+		}
+		_, err := io.WriteString(w, tail)
+		return err
+	})
+	mux, err := New(WithRouteFileSystem("files", "static", tails))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("root", expectFromRequest(mux, httptest.NewRequest(http.MethodGet, "/static/", nil), http.StatusOK, "/"))
+	t.Run("file", expectFromRequest(mux, httptest.NewRequest(http.MethodGet, "/static/css/app.css", nil), http.StatusOK, "/css/app.css"))
+	t.Run("directory", expectFromRequest(mux, httptest.NewRequest(http.MethodGet, "/static/docs/", nil), http.StatusOK, "/docs/"))
+	t.Run("redirect", expectFromRequest(mux, httptest.NewRequest(http.MethodGet, "/static", nil), http.StatusTemporaryRedirect, "<a href=\"/static/\">Temporary Redirect</a>.\n\n"))
+}
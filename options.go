@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/dkotik/oakmux/adapt"
 )
@@ -16,6 +18,7 @@ type options struct {
 	redirectFromTrailingSlash bool
 	limitlessRequestBytes     bool
 	maximumRequestBytes       int64
+	decompressionRatioLimit   int
 	handlers                  map[*Route]Handler
 	middleware                []Middleware
 	prefix                    string
@@ -77,6 +80,20 @@ func WithLimitlessRequestBytes() Option {
 	}
 }
 
+// WithRequestDecompression decompresses gzip and deflate request bodies. The request read limit applies to the decompressed body, which also may not expand beyond the ratio limit. See [NewRequestDecompressor].
+func WithRequestDecompression(ratioLimit int) Option {
+	return func(o *options) error {
+		if ratioLimit <= 0 {
+			return errors.New("compression ratio limit must be greater than 0")
+		}
+		if o.decompressionRatioLimit != 0 {
+			return fmt.Errorf("request decompression is already enabled with ratio limit: %d", o.decompressionRatioLimit)
+		}
+		o.decompressionRatioLimit = ratioLimit
+		return nil
+	}
+}
+
 func WithRouteHandler(name, pattern string, h Handler, mws ...Middleware) Option {
 	return func(o *options) error {
 		if name == "" {
@@ -103,6 +120,25 @@ func WithRouteHandler(name, pattern string, h Handler, mws ...Middleware) Option
 	}
 }
 
+// WithRouteFileSystem mounts a file system handler, like staticfs.FS, under the path prefix. It registers the named route for "prefix/[...path]" and a route with ":root" name suffix for "prefix/". The handler finds the requested file using [RoutingContext.Tail]. Files are streamed through [WithTimeout] without buffering, see [SkipTimeoutBuffering].
+func WithRouteFileSystem(name, prefix string, h Handler, mws ...Middleware) Option {
+	return func(o *options) error {
+		mws = append([]Middleware{SkipTimeoutBuffering}, mws...)
+		prefix = strings.Trim(prefix, "/")
+		if prefix != "" {
+			prefix = "/" + prefix
+		}
+		if err := WithRouteHandler(name, prefix+"/[...path]", h, mws...)(o); err != nil {
+			return err
+		}
+		if err := WithRouteHandler(name+":root", prefix+"/", h, mws...)(o); err != nil {
+			return err
+		}
+		o.routes[name+":root"].mountRoot = true
+		return nil
+	}
+}
+
 func WithRouteFunc[T any, V adapt.Validatable[T], O any](
 	name, pattern string,
 	domainCall func(context.Context, V) (O, error),
@@ -280,6 +316,29 @@ func WithMiddleware(mws ...Middleware) Option {
 	}
 }
 
+// WithTimeout sets a deadline for every route in the multiplexer. Individual routes can shorten it using [NewTimeoutMiddleware]. Responses are buffered until the handler returns, unless the handler flushes or the route uses [SkipTimeoutBuffering].
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) error {
+		if d <= 0 {
+			return errors.New("timeout must be greater than 0")
+		}
+		return WithMiddleware(NewTimeoutMiddleware(d))(o)
+	}
+}
+
+// WithClientTimeout is [WithTimeout] that honours the [RequestTimeoutHeader] capped by the maximum.
+func WithClientTimeout(d, maximum time.Duration) Option {
+	return func(o *options) error {
+		if d <= 0 {
+			return errors.New("timeout must be greater than 0")
+		}
+		if maximum < d {
+			return fmt.Errorf("maximum client timeout %s is less than the default timeout %s", maximum, d)
+		}
+		return WithMiddleware(NewClientTimeoutMiddleware(d, maximum))(o)
+	}
+}
+
 func WithPrefix(p string) Option {
 	return func(o *options) error {
 		if p == "" {
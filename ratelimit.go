@@ -0,0 +1,301 @@
+package oakmux
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TooManyRequestsError is returned by the rate limiting [Middleware] when a client exhausts its allowance.
+type TooManyRequestsError struct {
+	key        string
+	retryAfter time.Duration
+}
+
+func (e *TooManyRequestsError) Error() string {
+	return http.StatusText(http.StatusTooManyRequests)
+}
+
+func (e *TooManyRequestsError) HyperTextStatusCode() int {
+	return http.StatusTooManyRequests
+}
+
+// RetryAfter returns the duration after which the request is likely to be allowed.
+func (e *TooManyRequestsError) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
+func (e *TooManyRequestsError) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("message", "rate limit exceeded"),
+		slog.String("key", e.key),
+		slog.Duration("retryAfter", e.retryAfter),
+	)
+}
+
+// RateLimitKeyFunc extracts one part of the rate limiting key from a request. Returning an empty string exempts the request from rate limiting.
+type RateLimitKeyFunc func(*http.Request) (string, error)
+
+// RateLimitByClientIP keys requests by the remote address host. Behind a reverse proxy, all clients share the address of the proxy, see [RateLimitByForwardedClientIP].
+func RateLimitByClientIP(r *http.Request) (string, error) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr, nil // no port
+	}
+	return host, nil
+}
+
+// RateLimitByForwardedClientIP keys requests by the remote address host, unless the request arrives from one of the trusted reverse proxies, given as IP addresses or CIDR networks. Then, the request is keyed by the right-most X-Forwarded-For address that does not belong to a trusted proxy, because the values to the left of it can be forged by the client.
+func RateLimitByForwardedClientIP(proxies ...string) (RateLimitKeyFunc, error) {
+	trusted, err := newTrustedProxies(proxies)
+	if err != nil {
+		return nil, fmt.Errorf("cannot rate limit by forwarded client IP: %w", err)
+	}
+	return func(r *http.Request) (string, error) {
+		return trusted.ClientAddress(r), nil
+	}, nil
+}
+
+// RateLimitByRouteName keys requests by [Route.Name] from the [RoutingContext].
+func RateLimitByRouteName(r *http.Request) (string, error) {
+	routing := GetRoutingContext(r.Context())
+	if routing == nil {
+		return "", errors.New("rate limited request has no routing context")
+	}
+	return routing.Route().Name(), nil
+}
+
+// RateLimitByPrincipal keys requests by the authenticated principal provided by the given function. Unauthenticated requests fall back to [RateLimitByClientIP], so that anonymous clients do not share a single allowance.
+func RateLimitByPrincipal(principal func(*http.Request) (string, bool)) RateLimitKeyFunc {
+	if principal == nil {
+		panic("cannot use a <nil> principal function")
+	}
+	return func(r *http.Request) (string, error) {
+		name, ok := principal(r)
+		if !ok || name == "" {
+			return RateLimitByClientIP(r)
+		}
+		return "@" + name, nil // addresses never start with @
+	}
+}
+
+type rateLimitOptions struct {
+	limit          int
+	window         time.Duration
+	burst          int
+	idleExpiration time.Duration
+	keys           []RateLimitKeyFunc
+}
+
+type RateLimitOption func(*rateLimitOptions) error
+
+// WithRateLimitOf allows a number of requests per window, refilling the allowance evenly.
+func WithRateLimitOf(requests int, window time.Duration) RateLimitOption {
+	return func(o *rateLimitOptions) error {
+		if requests <= 0 {
+			return errors.New("request limit must be greater than 0")
+		}
+		if window <= 0 {
+			return errors.New("rate limit window must be greater than 0")
+		}
+		if o.limit != 0 {
+			return fmt.Errorf("rate limit is already set to %d per %s", o.limit, o.window)
+		}
+		o.limit = requests
+		o.window = window
+		return nil
+	}
+}
+
+// WithRateLimitBurstOf sets the maximum number of requests that can be made at once. Defaults to the request limit.
+func WithRateLimitBurstOf(requests int) RateLimitOption {
+	return func(o *rateLimitOptions) error {
+		if requests <= 0 {
+			return errors.New("burst must be greater than 0")
+		}
+		if o.burst != 0 {
+			return fmt.Errorf("burst is already set to: %d", o.burst)
+		}
+		o.burst = requests
+		return nil
+	}
+}
+
+// WithRateLimitIdleExpiration removes the tracking state of keys that were not seen for the duration. It cannot be shorter than the time it takes to refill the burst, otherwise clients would get a full allowance back early. Defaults to the refill time.
+func WithRateLimitIdleExpiration(d time.Duration) RateLimitOption {
+	return func(o *rateLimitOptions) error {
+		if d <= 0 {
+			return errors.New("idle expiration must be greater than 0")
+		}
+		if o.idleExpiration != 0 {
+			return fmt.Errorf("idle expiration is already set to: %s", o.idleExpiration)
+		}
+		o.idleExpiration = d
+		return nil
+	}
+}
+
+// WithRateLimitKeys combines the key functions into the rate limiting key. Defaults to [RateLimitByClientIP].
+func WithRateLimitKeys(keys ...RateLimitKeyFunc) RateLimitOption {
+	return func(o *rateLimitOptions) error {
+		if len(keys) == 0 {
+			return errors.New("empty rate limit key function list")
+		}
+		for i, key := range keys {
+			if key == nil {
+				return fmt.Errorf("rate limit key function #%d is <nil>", len(o.keys)+i)
+			}
+		}
+		o.keys = append(o.keys, keys...)
+		return nil
+	}
+}
+
+// NewRateLimitMiddleware creates a token bucket rate limiting [Middleware]. Each request reports its allowance using the RateLimit-Limit, RateLimit-Remaining, and RateLimit-Reset headers. Rejected requests receive a Retry-After header and a [TooManyRequestsError].
+func NewRateLimitMiddleware(withOptions ...RateLimitOption) (Middleware, error) {
+	o := &rateLimitOptions{}
+	for _, option := range append(
+		withOptions,
+		func(o *rateLimitOptions) error {
+			if o.limit == 0 {
+				return errors.New("rate limit is required")
+			}
+			if o.burst == 0 {
+				o.burst = o.limit
+			}
+			refill := time.Duration(float64(o.window) * float64(o.burst) / float64(o.limit))
+			if o.idleExpiration == 0 {
+				o.idleExpiration = refill
+			} else if o.idleExpiration < refill {
+				return fmt.Errorf("idle expiration %s is shorter than the time to refill the burst of %d requests: %s", o.idleExpiration, o.burst, refill)
+			}
+			if len(o.keys) == 0 {
+				o.keys = []RateLimitKeyFunc{RateLimitByClientIP}
+			}
+			return nil
+		},
+	) {
+		if err := option(o); err != nil {
+			return nil, fmt.Errorf("cannot create rate limiting middleware: %w", err)
+		}
+	}
+
+	limiter := &rateLimiter{
+		rate:           float64(o.limit) / o.window.Seconds(),
+		burst:          float64(o.burst),
+		idleExpiration: o.idleExpiration,
+		buckets:        make(map[string]*tokenBucket),
+		nextSweep:      time.Now().Add(o.idleExpiration),
+	}
+	keys := o.keys
+	return func(next Handler) Handler {
+		return HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+			key, err := rateLimitKey(r, keys)
+			if err != nil {
+				return fmt.Errorf("unable to build rate limit key: %w", err)
+			}
+			if key == "" {
+				return next.ServeHyperText(w, r)
+			}
+			allowed, remaining, reset, retryAfter := limiter.Take(key, time.Now())
+			header := w.Header()
+			header.Set("RateLimit-Limit", strconv.Itoa(o.burst))
+			header.Set("RateLimit-Remaining", strconv.Itoa(remaining))
+			header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(reset)))
+			if !allowed {
+				header.Set("Retry-After", strconv.Itoa(ceilSeconds(retryAfter)))
+				return &TooManyRequestsError{key: key, retryAfter: retryAfter}
+			}
+			return next.ServeHyperText(w, r)
+		})
+	}, nil
+}
+
+func rateLimitKey(r *http.Request, keys []RateLimitKeyFunc) (string, error) {
+	if len(keys) == 1 {
+		return keys[0](r)
+	}
+	b := strings.Builder{}
+	for i, key := range keys {
+		part, err := key(r)
+		if err != nil {
+			return "", err
+		}
+		if part == "" {
+			return "", nil // exempt
+		}
+		if i > 0 {
+			_ = b.WriteByte('|')
+		}
+		_, _ = b.WriteString(part)
+	}
+	return b.String(), nil
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+type tokenBucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+type rateLimiter struct {
+	mu             sync.Mutex
+	rate           float64 // tokens per second
+	burst          float64
+	idleExpiration time.Duration
+	buckets        map[string]*tokenBucket
+	nextSweep      time.Time
+}
+
+// Take spends one token from the bucket under the key.
+func (l *rateLimiter) Take(key string, now time.Time) (
+	allowed bool,
+	remaining int,
+	reset time.Duration,
+	retryAfter time.Duration,
+) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !now.Before(l.nextSweep) {
+		for known, bucket := range l.buckets {
+			if now.Sub(bucket.lastSeen) > l.idleExpiration {
+				delete(l.buckets, known)
+			}
+		}
+		l.nextSweep = now.Add(l.idleExpiration)
+	}
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst, lastSeen: now}
+		l.buckets[key] = bucket
+	} else {
+		bucket.tokens = math.Min(
+			l.burst,
+			bucket.tokens+now.Sub(bucket.lastSeen).Seconds()*l.rate,
+		)
+		bucket.lastSeen = now
+	}
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		allowed = true
+	} else {
+		retryAfter = time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+	}
+	return allowed,
+		int(bucket.tokens),
+		time.Duration((l.burst - bucket.tokens) / l.rate * float64(time.Second)),
+		retryAfter
+}
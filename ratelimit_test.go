@@ -0,0 +1,144 @@
+package oakmux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	limiter, err := NewRateLimitMiddleware(
+		WithRateLimitOf(2, time.Minute),
+		WithRateLimitKeys(RateLimitByClientIP, RateLimitByRouteName),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux, err := New(
+		WithRouteHandler("login", "/login", newTestHandler(t), limiter),
+		WithRouteHandler("search", "/search", newTestHandler(t), limiter),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectFromRequest(mux, httptest.NewRequest(http.MethodPost, "/login", nil), http.StatusOK, "/login")(t)
+	expectFromRequest(mux, httptest.NewRequest(http.MethodPost, "/login", nil), http.StatusOK, "/login")(t)
+	expectFromRequest(mux, httptest.NewRequest(http.MethodPost, "/search", nil), http.StatusOK, "/search")(t)
+
+	w := httptest.NewRecorder()
+	err = mux.ServeHyperText(w, httptest.NewRequest(http.MethodPost, "/login", nil))
+	if _, ok := err.(*TooManyRequestsError); !ok {
+		t.Fatal("expected a rate limiting error, got:", err)
+	}
+	if w.Header().Get("Retry-After") != "30" {
+		t.Fatalf("unexpected Retry-After header: %q", w.Header().Get("Retry-After"))
+	}
+	if w.Header().Get("RateLimit-Remaining") != "0" {
+		t.Fatalf("unexpected RateLimit-Remaining header: %q", w.Header().Get("RateLimit-Remaining"))
+	}
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	limiter := &rateLimiter{
+		rate:           1,
+		burst:          1,
+		idleExpiration: time.Second,
+		buckets:        make(map[string]*tokenBucket),
+	}
+	now := time.Now()
+	if allowed, _, _, _ := limiter.Take("key", now); !allowed {
+		t.Fatal("first request was rejected")
+	}
+	if allowed, _, _, _ := limiter.Take("key", now); allowed {
+		t.Fatal("second request was allowed")
+	}
+	if allowed, _, _, _ := limiter.Take("key", now.Add(time.Second)); !allowed {
+		t.Fatal("request after refill was rejected")
+	}
+	limiter.Take("other", now.Add(time.Second*3))
+	if _, ok := limiter.buckets["key"]; ok {
+		t.Fatal("idle key was not expired")
+	}
+}
+
+func TestRateLimitIdleExpiration(t *testing.T) {
+	if _, err := NewRateLimitMiddleware(
+		WithRateLimitOf(1, time.Minute),
+		WithRateLimitBurstOf(10),
+		WithRateLimitIdleExpiration(time.Minute),
+	); err == nil {
+		t.Fatal("idle expiration shorter than the refill time was accepted")
+	}
+	if _, err := NewRateLimitMiddleware(
+		WithRateLimitOf(1, time.Minute),
+		WithRateLimitBurstOf(10),
+		WithRateLimitIdleExpiration(time.Minute*10),
+	); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRateLimitByForwardedClientIP(t *testing.T) {
+	key, err := RateLimitByForwardedClientIP("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		RemoteAddr string
+		Forwarded  string
+		Expected   string
+	}{
+		{RemoteAddr: "192.0.2.1:1234", Forwarded: "198.51.100.1", Expected: "192.0.2.1"},
+		{RemoteAddr: "10.0.0.1:1234", Forwarded: "198.51.100.1", Expected: "198.51.100.1"},
+		{RemoteAddr: "10.0.0.1:1234", Forwarded: "203.0.113.9, 198.51.100.1, 10.0.0.2", Expected: "198.51.100.1"},
+		{RemoteAddr: "10.0.0.1:1234", Forwarded: "forged, 198.51.100.1", Expected: "198.51.100.1"},
+		{RemoteAddr: "10.0.0.1:1234", Expected: "10.0.0.1"},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = c.RemoteAddr
+		if c.Forwarded != "" {
+			r.Header.Set("X-Forwarded-For", c.Forwarded)
+		}
+		client, err := key(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if client != c.Expected {
+			t.Fatalf("request from %s forwarded for %q was keyed by %q instead of %q", c.RemoteAddr, c.Forwarded, client, c.Expected)
+		}
+	}
+}
+
+func TestRateLimitByPrincipal(t *testing.T) {
+	key := RateLimitByPrincipal(func(r *http.Request) (string, bool) {
+		name := r.Header.Get("X-User")
+		return name, name != ""
+	})
+	cases := []struct {
+		RemoteAddr string
+		User       string
+		Expected   string
+	}{
+		{RemoteAddr: "192.0.2.1:1234", User: "alice", Expected: "@alice"},
+		{RemoteAddr: "192.0.2.2:1234", User: "alice", Expected: "@alice"},
+		{RemoteAddr: "192.0.2.1:1234", Expected: "192.0.2.1"},
+		{RemoteAddr: "192.0.2.2:1234", Expected: "192.0.2.2"},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = c.RemoteAddr
+		if c.User != "" {
+			r.Header.Set("X-User", c.User)
+		}
+		client, err := key(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if client != c.Expected {
+			t.Fatalf("request from %s by %q was keyed by %q instead of %q", c.RemoteAddr, c.User, client, c.Expected)
+		}
+	}
+}
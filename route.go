@@ -9,6 +9,7 @@ type Route struct {
 	name          string
 	segments      []Segment
 	namedSegments []Segment
+	mountRoot     bool // serves the root of a terminal route, see [WithRouteFileSystem]
 }
 
 func munchPath(p string) (
@@ -0,0 +1,185 @@
+package staticfs
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/dkotik/oakmux"
+)
+
+var defaultIndexNames = []string{"index.html"}
+
+type listingEntry struct {
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	Directory bool   `json:"directory,omitempty"`
+	Size      int64  `json:"size,omitempty"`
+}
+
+// directory is served for an external path ending with a slash. It either points to an index file or lists the published entries.
+type directory struct {
+	index   *file
+	entries []listingEntry
+}
+
+var listingTemplate = template.Must(template.New("listing").Parse(`<!doctype html>
+<html>
+<head><meta charset="utf-8"><title>Index of {{ .Path }}</title></head>
+<body>
+<h1>Index of {{ .Path }}</h1>
+<ul>
+{{- if ne .Path "/" }}
+<li><a href="../">../</a></li>
+{{- end }}
+{{- range .Entries }}
+<li><a href="{{ .Path }}">{{ .Name }}{{ if .Directory }}/{{ end }}</a></li>
+{{- end }}
+</ul>
+</body>
+</html>
+`))
+
+// directoryPath returns the external path of the directory that contains the external file path, with a trailing slash.
+func directoryPath(external string) string {
+	parent := path.Dir(external)
+	if parent == "/" {
+		return parent
+	}
+	return parent + "/"
+}
+
+// buildDirectories resolves index files by external or real name from the logical external paths and, with listing enabled, collects the entries of every directory from the final external paths, which may be fingerprinted.
+func buildDirectories(
+	logical map[string]*file,
+	final map[string]*file,
+	indexNames []string,
+	listing bool,
+) map[string]*directory {
+	directories := make(map[string]*directory)
+	preference := make(map[string]int)
+	for external, f := range logical {
+		name, real := path.Base(external), path.Base(f.path)
+		stripped := name == strings.TrimSuffix(real, path.Ext(real)) // see [StripExtensions]
+		for rank, indexName := range indexNames {
+			if name != indexName && !(stripped && real == indexName) {
+				continue
+			}
+			parent := directoryPath(external)
+			if current, ok := preference[parent]; ok && current <= rank {
+				break
+			}
+			preference[parent] = rank
+			directories[parent] = &directory{index: f}
+			break
+		}
+	}
+	if !listing {
+		return directories
+	}
+
+	listed := make(map[string]map[string]listingEntry)
+	add := func(parent string, entry listingEntry) {
+		if _, ok := directories[parent]; ok {
+			return // the index file takes precedence
+		}
+		entries, ok := listed[parent]
+		if !ok {
+			entries = make(map[string]listingEntry)
+			listed[parent] = entries
+		}
+		entries[entry.Name] = entry
+	}
+	for external, f := range final {
+		add(directoryPath(external), listingEntry{
+			Name: path.Base(external),
+			Path: external,
+			Size: f.size,
+		})
+		for current := path.Dir(external); current != "/"; current = path.Dir(current) {
+			add(directoryPath(current), listingEntry{
+				Name:      path.Base(current),
+				Path:      current + "/",
+				Directory: true,
+			})
+		}
+	}
+	for parent, entries := range listed {
+		d := &directory{entries: make([]listingEntry, 0, len(entries))}
+		for _, name := range sortedKeys(entries) {
+			d.entries = append(d.entries, entries[name])
+		}
+		sortListing(d.entries)
+		directories[parent] = d
+	}
+	return directories
+}
+
+// trailingSlashAlternative returns the external path with the trailing slash added or removed.
+func trailingSlashAlternative(external string) string {
+	if external == "/" {
+		return ""
+	}
+	if strings.HasSuffix(external, "/") {
+		return strings.TrimSuffix(external, "/")
+	}
+	return external + "/"
+}
+
+// prefersJSON reports whether the Accept header ranks JSON above HTML.
+func prefersJSON(accept string) bool {
+	jsonAt := strings.Index(accept, "application/json")
+	if jsonAt < 0 {
+		return false
+	}
+	htmlAt := strings.Index(accept, "text/html")
+	return htmlAt < 0 || jsonAt < htmlAt
+}
+
+func (fs *FS) serveListing(
+	w http.ResponseWriter,
+	r *http.Request,
+	d *directory,
+	requested string,
+	mount string,
+) error {
+	entries := d.entries
+	if mount != "" {
+		entries = make([]listingEntry, len(d.entries))
+		for i, entry := range d.entries {
+			entry.Path = mount + entry.Path
+			entries[i] = entry
+		}
+	}
+	header := w.Header()
+	oakmux.AddVary(header, "Accept")
+	header.Set("Cache-Control", "no-cache")
+	if prefersJSON(r.Header.Get("Accept")) {
+		header.Set("Content-Type", "application/json; charset=utf-8")
+		if r.Method == http.MethodHead {
+			return nil
+		}
+		return json.NewEncoder(w).Encode(entries)
+	}
+	header.Set("Content-Type", "text/html; charset=utf-8")
+	if r.Method == http.MethodHead {
+		return nil
+	}
+	return listingTemplate.Execute(w, struct {
+		Path    string
+		Entries []listingEntry
+	}{
+		Path:    requested,
+		Entries: entries,
+	})
+}
+
+// sortListing orders directories before files.
+func sortListing(entries []listingEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Directory && !entries[j].Directory
+	})
+}
@@ -0,0 +1,78 @@
+package staticfs
+
+import (
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+// Exclusion describes a file or directory that was left out of the index by a filter.
+type Exclusion struct {
+	Path   string
+	Layer  string
+	Reason string
+}
+
+func (e Exclusion) String() string {
+	return fmt.Sprintf("%s@%s: %s", e.Path, e.Layer, e.Reason)
+}
+
+// filter returns the reason for leaving the walked entry out of the index or an empty string, if the entry is published.
+func (o *options) filter(fileSystem fs.FS, real string, d fs.DirEntry) (reason string, err error) {
+	if real == "." {
+		return "", nil
+	}
+	if d.Type()&fs.ModeSymlink != 0 {
+		if info, err := fs.Stat(fileSystem, real); err != nil || info.IsDir() {
+			return "symbolic link to a directory or a missing file", nil // walking it could loop
+		}
+	}
+	name := d.Name()
+	if o.WritableRoot != "" && strings.HasPrefix(name, writableTemporaryPrefix) {
+		return "temporary file of a write in progress", nil
+	}
+	if !o.Hidden && strings.HasPrefix(name, ".") && !(d.IsDir() && name == ".well-known") {
+		return "hidden", nil
+	}
+	if reason := o.match(real, d.IsDir()); reason != "" || d.IsDir() {
+		return reason, nil
+	}
+	if o.MaxFileSize > 0 {
+		info, err := fs.Stat(fileSystem, real) // follows symbolic links
+		if err != nil {
+			return "", err
+		}
+		if info.Size() > o.MaxFileSize {
+			return fmt.Sprintf("size of %d bytes exceeds the limit of %d", info.Size(), o.MaxFileSize), nil
+		}
+	}
+	return "", nil
+}
+
+// match returns the reason for leaving the path out of the index by the [WithExclude] and [WithInclude] patterns or an empty string. Include patterns apply only to files.
+func (o *options) match(real string, directory bool) string {
+	for _, pattern := range o.Exclude {
+		if matchPattern(pattern, real) {
+			return "excluded by pattern " + pattern
+		}
+	}
+	if directory || len(o.Include) == 0 {
+		return ""
+	}
+	for _, pattern := range o.Include {
+		if matchPattern(pattern, real) {
+			return ""
+		}
+	}
+	return "not included by any pattern"
+}
+
+// Exclusions reports the files and directories left out of the index by [WithHiddenFiles], [WithInclude], [WithExclude], and [WithMaximumFileSizeOf] filters, ordered by path. The contents of excluded directories are not listed.
+func (fs *FS) Exclusions() []Exclusion {
+	exclusions := append([]Exclusion(nil), fs.current.Load().exclusions...)
+	sort.SliceStable(exclusions, func(i, j int) bool {
+		return exclusions[i].Path < exclusions[j].Path
+	})
+	return exclusions
+}
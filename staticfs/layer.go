@@ -0,0 +1,34 @@
+package staticfs
+
+import (
+	"fmt"
+	"io/fs"
+)
+
+const baseLayerName = "base"
+
+// layer is one of the stacked file systems. Files of a higher layer shadow the files with the same external path in the lower layers.
+type layer struct {
+	name       string
+	fileSystem fs.FS
+}
+
+func (l *layer) String() string {
+	return l.name
+}
+
+// source locates a real file within a layer.
+type source struct {
+	real  string
+	layer *layer
+}
+
+// resolve finds the layer with the highest precedence that contains the real path.
+func (o *options) resolve(real string) (*layer, error) {
+	for _, l := range o.Layers {
+		if _, err := fs.Stat(l.fileSystem, real); err == nil {
+			return l, nil
+		}
+	}
+	return nil, fmt.Errorf("file %q is not present in any layer", real)
+}
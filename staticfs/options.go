@@ -4,15 +4,39 @@ import (
 	"errors"
 	"fmt"
 	"io/fs"
+	"mime"
 	"os"
+	"path"
+	"strings"
 )
 
+// PathTranslator maps a real file path to the external request path or rejects the file. Translators are applied in order, each receiving the output of the previous one, and the file is published under the final path. The first translator receives the real path without the leading slash.
 type PathTranslator func(real string) (external string, accept bool, err error)
 
+type cachePolicy struct {
+	pattern string
+	value   string
+}
+
 type options struct {
-	Index       map[string]string
-	Translators []PathTranslator
-	FileSystem  fs.FS
+	Index         map[string]string
+	Translators   []PathTranslator
+	Layers        []*layer // in the order of precedence
+	CachePolicies []cachePolicy
+	Fingerprint   bool
+	Redirect      bool
+	Fallback      string
+	NotFound      string
+	IndexNames    []string
+	Listing       bool
+	ContentTypes  map[string]string
+	Hidden        bool
+	Include       []string
+	Exclude       []string
+	MaxFileSize   int64
+	Aliases       map[string]string
+	Canonical     bool
+	WritableRoot  string
 }
 
 type Option func(*options) error
@@ -28,6 +52,37 @@ func WithPath(external, real string) Option {
 	}
 }
 
+// WithAlias permanently redirects the secondary external path to the canonical external path of a published file.
+func WithAlias(alias, canonical string) Option {
+	return func(o *options) error {
+		if !strings.HasPrefix(alias, "/") || !strings.HasPrefix(canonical, "/") {
+			return fmt.Errorf("alias %q and canonical path %q must begin with a slash", alias, canonical)
+		}
+		if alias == canonical {
+			return fmt.Errorf("alias %q points to itself", alias)
+		}
+		if current, ok := o.Aliases[alias]; ok {
+			return fmt.Errorf("alias %q already points to %q", alias, current)
+		}
+		if o.Aliases == nil {
+			o.Aliases = make(map[string]string)
+		}
+		o.Aliases[alias] = canonical
+		return nil
+	}
+}
+
+// WithCanonicalRedirects permanently redirects the untranslated path of every file, like "/about.html", to the path produced by the translators, like "/about", unless another file is published there.
+func WithCanonicalRedirects() Option {
+	return func(o *options) error {
+		if o.Canonical {
+			return errors.New("canonical redirects are already enabled")
+		}
+		o.Canonical = true
+		return nil
+	}
+}
+
 func WithPathTranslators(ts ...PathTranslator) Option {
 	return func(o *options) error {
 		if len(ts) == 0 {
@@ -43,15 +98,37 @@ func WithPathTranslators(ts ...PathTranslator) Option {
 	}
 }
 
+// WithFileSystem sets the base layer, which has the lowest precedence. See [WithLayer].
 func WithFileSystem(fs fs.FS) Option {
 	return func(o *options) (err error) {
 		if fs == nil {
 			return errors.New("unable to use a <nil> file system")
 		}
-		if o.FileSystem != nil {
-			return errors.New("file system is already set")
+		for _, existing := range o.Layers {
+			if existing.name == baseLayerName {
+				return errors.New("file system is already set")
+			}
+		}
+		o.Layers = append(o.Layers, &layer{name: baseLayerName, fileSystem: fs})
+		return nil
+	}
+}
+
+// WithLayer adds a named file system layer that shadows the files of the base layer and of every layer added before it. It lets operators override individual embedded files from a directory.
+func WithLayer(name string, fs fs.FS) Option {
+	return func(o *options) (err error) {
+		if name == "" {
+			return errors.New("cannot use an empty layer name")
+		}
+		if fs == nil {
+			return fmt.Errorf("unable to use a <nil> file system for layer %q", name)
+		}
+		for _, existing := range o.Layers {
+			if existing.name == name {
+				return fmt.Errorf("layer %q is already set", name)
+			}
 		}
-		o.FileSystem = fs
+		o.Layers = append([]*layer{{name: name, fileSystem: fs}}, o.Layers...)
 		return nil
 	}
 }
@@ -59,3 +136,210 @@ func WithFileSystem(fs fs.FS) Option {
 func WithDirectory(p string) Option {
 	return WithFileSystem(os.DirFS(p))
 }
+
+// WithCacheControl sets the Cache-Control header for files whose real path matches the [path.Match] pattern. Patterns without a slash match the base name of the file. The first matching policy applies.
+func WithCacheControl(pattern, value string) Option {
+	return func(o *options) error {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid cache control pattern %q: %w", pattern, err)
+		}
+		if value == "" {
+			return errors.New("cannot use an empty cache control value")
+		}
+		for _, policy := range o.CachePolicies {
+			if policy.pattern == pattern {
+				return fmt.Errorf("cache control for pattern %q is already set to %q", pattern, policy.value)
+			}
+		}
+		o.CachePolicies = append(o.CachePolicies, cachePolicy{
+			pattern: pattern,
+			value:   value,
+		})
+		return nil
+	}
+}
+
+// WithContentType overrides the Content-Type header for files with the given extension, like ".mjs" or ".webmanifest", which the platform MIME tables may not know.
+func WithContentType(extension, contentType string) Option {
+	return func(o *options) error {
+		if !strings.HasPrefix(extension, ".") || len(extension) < 2 {
+			return fmt.Errorf("invalid file extension %q", extension)
+		}
+		if _, _, err := mime.ParseMediaType(contentType); err != nil {
+			return fmt.Errorf("invalid content type %q: %w", contentType, err)
+		}
+		extension = strings.ToLower(extension)
+		if current, ok := o.ContentTypes[extension]; ok {
+			return fmt.Errorf("content type for extension %q is already set to %q", extension, current)
+		}
+		if o.ContentTypes == nil {
+			o.ContentTypes = make(map[string]string)
+		}
+		o.ContentTypes[extension] = contentType
+		return nil
+	}
+}
+
+// contentType resolves the Content-Type of a file from its extension, preferring the overrides.
+func (o *options) contentType(real string) string {
+	extension := strings.ToLower(path.Ext(real))
+	if contentType, ok := o.ContentTypes[extension]; ok {
+		return contentType
+	}
+	return mime.TypeByExtension(extension)
+}
+
+func (o *options) cacheControl(real string) string {
+	for _, policy := range o.CachePolicies {
+		if matchPattern(policy.pattern, real) {
+			return policy.value
+		}
+	}
+	return ""
+}
+
+// WithFingerprints embeds a content hash into every external path, like "/app.3f9a1c2b.js", to enable immutable caching. Use [FS.URL] to resolve the logical name of a file to its fingerprinted path. Files without a matching [WithCacheControl] policy are marked immutable.
+func WithFingerprints() Option {
+	return func(o *options) error {
+		if o.Fingerprint {
+			return errors.New("fingerprints are already enabled")
+		}
+		o.Fingerprint = true
+		return nil
+	}
+}
+
+// WithFingerprintRedirects enables [WithFingerprints] and temporarily redirects the original paths to the fingerprinted ones instead of hiding them.
+func WithFingerprintRedirects() Option {
+	return func(o *options) error {
+		if o.Redirect {
+			return errors.New("fingerprint redirects are already enabled")
+		}
+		o.Redirect = true
+		if o.Fingerprint {
+			return nil
+		}
+		return WithFingerprints()(o)
+	}
+}
+
+// WithFallback serves the file, usually "index.html", for unmatched paths that look like browser navigations: safe requests that accept "text/html" for paths without an extension. It lets single-page applications handle client-side routes on reload.
+func WithFallback(name string) Option {
+	return func(o *options) error {
+		if name == "" {
+			return errors.New("cannot use an empty fallback file name")
+		}
+		if o.Fallback != "" {
+			return fmt.Errorf("fallback file is already set to %q", o.Fallback)
+		}
+		o.Fallback = name
+		return nil
+	}
+}
+
+// WithNotFoundPage renders the file with [http.StatusNotFound] status for unmatched paths instead of returning [ErrNotFound].
+func WithNotFoundPage(name string) Option {
+	return func(o *options) error {
+		if name == "" {
+			return errors.New("cannot use an empty not found page file name")
+		}
+		if o.NotFound != "" {
+			return fmt.Errorf("not found page is already set to %q", o.NotFound)
+		}
+		o.NotFound = name
+		return nil
+	}
+}
+
+// WithIndexNames sets the file names, in the order of preference, that are served for a directory path ending with a slash. Defaults to "index.html".
+func WithIndexNames(names ...string) Option {
+	return func(o *options) error {
+		if len(names) == 0 {
+			return errors.New("empty index name list")
+		}
+		if len(o.IndexNames) > 0 {
+			return fmt.Errorf("index names are already set to %q", o.IndexNames)
+		}
+		for i, name := range names {
+			if name == "" || strings.Contains(name, "/") {
+				return fmt.Errorf("index name #%d %q is not a base file name", i, name)
+			}
+		}
+		o.IndexNames = names
+		return nil
+	}
+}
+
+// WithDirectoryListing renders the contents of directories without an index file as HTML or, if the client prefers, JSON. Only published files are listed, so the listing respects the decisions of the path translators.
+func WithDirectoryListing() Option {
+	return func(o *options) error {
+		if o.Listing {
+			return errors.New("directory listing is already enabled")
+		}
+		o.Listing = true
+		return nil
+	}
+}
+
+// WithHiddenFiles publishes files and directories whose names begin with a dot. They are excluded by default, except for the ".well-known" directory, to avoid leaking ".env" or ".git" contents.
+func WithHiddenFiles() Option {
+	return func(o *options) error {
+		if o.Hidden {
+			return errors.New("hidden files are already published")
+		}
+		o.Hidden = true
+		return nil
+	}
+}
+
+// WithInclude publishes only the files whose real path matches one of the [path.Match] patterns. Patterns without a slash match the base name of the file.
+func WithInclude(patterns ...string) Option {
+	return func(o *options) (err error) {
+		if o.Include, err = appendPatterns(o.Include, patterns); err != nil {
+			return fmt.Errorf("cannot include files: %w", err)
+		}
+		return nil
+	}
+}
+
+// WithExclude leaves out the files and directories whose real path matches one of the [path.Match] patterns. Patterns without a slash match the base name. Exclusion takes precedence over [WithInclude].
+func WithExclude(patterns ...string) Option {
+	return func(o *options) (err error) {
+		if o.Exclude, err = appendPatterns(o.Exclude, patterns); err != nil {
+			return fmt.Errorf("cannot exclude files: %w", err)
+		}
+		return nil
+	}
+}
+
+func appendPatterns(existing, patterns []string) ([]string, error) {
+	if len(patterns) == 0 {
+		return nil, errors.New("empty pattern list")
+	}
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		for _, current := range existing {
+			if current == pattern {
+				return nil, fmt.Errorf("pattern %q is already set", pattern)
+			}
+		}
+		existing = append(existing, pattern)
+	}
+	return existing, nil
+}
+
+// WithMaximumFileSizeOf leaves out files larger than the given number of bytes.
+func WithMaximumFileSizeOf(maximumBytes int64) Option {
+	return func(o *options) error {
+		if maximumBytes <= 0 {
+			return errors.New("maximum file size must be greater than 0 bytes")
+		}
+		if o.MaxFileSize != 0 {
+			return fmt.Errorf("maximum file size is already set to: %d", o.MaxFileSize)
+		}
+		o.MaxFileSize = maximumBytes
+		return nil
+	}
+}
@@ -0,0 +1,117 @@
+package staticfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Reload rescans the file system and atomically replaces the index. Requests in flight finish with the index they started with. On error, the current index is kept.
+func (fs *FS) Reload() error {
+	fs.reloadMu.Lock()
+	defer fs.reloadMu.Unlock()
+	s, err := fs.options.build()
+	if err != nil {
+		return fmt.Errorf("cannot reload static file system: %w", err)
+	}
+	close(fs.current.Swap(s).replaced)
+	return nil
+}
+
+// Watch polls the file system for added, removed, or modified files at the given interval and calls [FS.Reload] when any change is detected. It is meant for development and blocks until the context is cancelled. Failed reloads are logged and retried on the next change.
+func (fs *FS) Watch(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		return errors.New("polling interval must be greater than 0")
+	}
+	last, err := signature(fs.options.Layers)
+	if err != nil {
+		return fmt.Errorf("cannot watch static file system: %w", err)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		current, err := signature(fs.options.Layers)
+		if err != nil {
+			slog.WarnContext(ctx, "cannot scan static file system", slog.Any("error", err))
+			continue
+		}
+		if current == last {
+			continue
+		}
+		last = current
+		if err = fs.Reload(); err != nil {
+			slog.WarnContext(ctx, "cannot reload static file system", slog.Any("error", err))
+		}
+	}
+}
+
+// signature summarizes the names, sizes, and modification times of all files in every layer without reading their contents.
+func signature(layers []*layer) (uint64, error) {
+	hash := fnv.New64a()
+	for _, l := range layers {
+		_, _ = fmt.Fprintf(hash, "%s\x00", l)
+		if err := fs.WalkDir(l.fileSystem, ".", func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			_, _ = fmt.Fprintf(hash, "%s\x00%d\x00%d\x00", path, info.Size(), info.ModTime().UnixNano())
+			return nil
+		}); err != nil {
+			return 0, err
+		}
+	}
+	return hash.Sum64(), nil
+}
+
+// ServeReloadEvents streams a server-sent "reload" event every time the index is replaced. Mount it on a development route and subscribe from the page:
+//
+//	<script>new EventSource("/reload").addEventListener("reload", () => location.reload())</script>
+func (fs *FS) ServeReloadEvents(
+	w http.ResponseWriter,
+	r *http.Request,
+) error {
+	controller := http.NewResponseController(w)
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write([]byte(": watching\n\n")); err != nil {
+		return err
+	}
+	if err := controller.Flush(); err != nil {
+		return fmt.Errorf("cannot stream reload events: %w", err)
+	}
+
+	s := fs.current.Load()
+	for {
+		select {
+		case <-r.Context().Done():
+			return nil
+		case <-s.replaced:
+		}
+		s = fs.current.Load()
+		if _, err := w.Write([]byte("event: reload\ndata: reload\n\n")); err != nil {
+			return err
+		}
+		if err := controller.Flush(); err != nil {
+			return err
+		}
+	}
+}
@@ -1,9 +1,17 @@
 package staticfs
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
 	"net/http"
+	"path"
+	"strings"
 
 	"log/slog"
+
+	"github.com/dkotik/oakmux"
 )
 
 var ErrNotFound = &NotFoundError{}
@@ -22,16 +30,162 @@ func (fs *FS) ServeHyperText(
 	w http.ResponseWriter,
 	r *http.Request,
 ) (err error) {
-	real, ok := fs.index[r.URL.Path]
+	s := fs.current.Load()
+	requested, mount := requestPath(r)
+	if fs.options.WritableRoot != "" {
+		if ok, err := fs.serveWrite(w, r, requested, mount); ok {
+			return err
+		}
+	}
+	f, ok := s.index[requested]
 	if !ok {
+		if d, ok := s.directories[requested]; ok {
+			if d.index != nil {
+				return fs.serveFile(w, r, d.index, http.StatusOK)
+			}
+			return fs.serveListing(w, r, d, requested, mount)
+		}
+		if target, ok := s.redirects[requested]; ok {
+			redirect(w, r, mount+target, http.StatusTemporaryRedirect)
+			return nil
+		}
+		if target, ok := s.aliases[requested]; ok {
+			redirect(w, r, mount+target, http.StatusPermanentRedirect)
+			return nil
+		}
+		if target := trailingSlashAlternative(requested); target != "" {
+			_, isFile := s.index[target]
+			_, isDirectory := s.directories[target]
+			if isFile || isDirectory {
+				redirect(w, r, mount+target, http.StatusTemporaryRedirect)
+				return nil
+			}
+		}
+		if s.fallback != nil && isNavigation(r) {
+			return fs.serveFile(w, r, s.fallback, http.StatusOK)
+		}
+		if s.notFound != nil {
+			return fs.serveFile(w, r, s.notFound, http.StatusNotFound)
+		}
 		return ErrNotFound
 	}
-	r.URL.Path = real // TODO: not kosher.
-	// r.URL.Path = "main.go"
-	fs.source.ServeHTTP(w, r)
+	return fs.serveFile(w, r, f, http.StatusOK)
+}
+
+// requestPath returns the path of the requested file. When the [FS] is mounted under a terminal route of [oakmux.New], the path is taken from the terminal segment and the mount returns the path prefix that precedes it.
+func requestPath(r *http.Request) (requested, mount string) {
+	if routing := oakmux.GetRoutingContext(r.Context()); routing != nil {
+		if tail, ok := routing.Tail(); ok {
+			return tail, strings.TrimSuffix(strings.TrimSuffix(r.URL.Path, tail), "/")
+		}
+	}
+	return r.URL.Path, ""
+}
+
+// redirect moves the request to the target path, preserving the query.
+func redirect(w http.ResponseWriter, r *http.Request, target string, statusCode int) {
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	http.Redirect(w, r, target, statusCode)
+}
+
+// isNavigation reports whether the request looks like a browser navigation to a client-side route: a safe request that accepts HTML for a path without an extension.
+func isNavigation(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if path.Ext(path.Base(r.URL.Path)) != "" {
+		return false
+	}
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+func (fs *FS) serveFile(
+	w http.ResponseWriter,
+	r *http.Request,
+	f *file,
+	statusCode int,
+) error {
+	header := w.Header()
+	header.Set("X-Content-Type-Options", "nosniff")
+	if statusCode != http.StatusOK {
+		// error pages are never ranged or revalidated
+		r = r.Clone(r.Context())
+		for _, name := range [...]string{"Range", "If-Range", "If-None-Match", "If-Modified-Since", "If-Match", "If-Unmodified-Since"} {
+			r.Header.Del(name)
+		}
+		w = &statusOverrideWriter{ResponseWriter: w, statusCode: statusCode}
+		header.Set("Cache-Control", "no-store")
+	} else if f.cacheControl != "" {
+		header.Set("Cache-Control", f.cacheControl)
+	}
+	served := f
+	if len(f.encodings) > 0 {
+		oakmux.AddVary(header, "Accept-Encoding")
+		if encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"), f.encodings); encoding != "" {
+			served = f.encodings[encoding]
+			header.Set("Content-Encoding", encoding)
+		}
+	}
+	if contentType := fs.options.contentType(f.path); contentType != "" {
+		header.Set("Content-Type", contentType)
+	} else if served != f {
+		// sniffing the compressed bytes would be wrong
+		header.Set("Content-Type", "application/octet-stream")
+	}
+	if statusCode == http.StatusOK {
+		header.Set("ETag", served.etag)
+	}
+
+	handle, err := served.layer.fileSystem.Open(served.path)
+	if err != nil {
+		if errors.Is(err, iofs.ErrNotExist) {
+			return ErrNotFound // removed since indexing
+		}
+		return err
+	}
+	defer handle.Close()
+	info, err := handle.Stat()
+	if err != nil {
+		return err
+	}
+	content, ok := handle.(io.ReadSeeker)
+	if !ok {
+		return fmt.Errorf("file %q cannot seek", served.path)
+	}
+	http.ServeContent(w, r, f.path, info.ModTime(), content)
 	return nil
 }
 
+// statusOverrideWriter replaces a successful status code, so that a file can be served as an error page.
+type statusOverrideWriter struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (s *statusOverrideWriter) WriteHeader(statusCode int) {
+	if statusCode == http.StatusOK {
+		statusCode = s.statusCode
+	}
+	s.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (s *statusOverrideWriter) Write(b []byte) (int, error) {
+	return s.ResponseWriter.Write(b)
+}
+
+// negotiateEncoding picks the available precompressed variant with the highest quality value from the Accept-Encoding header. Ties are resolved in the order of [precompressedExtensions].
+func negotiateEncoding(header string, available map[string]*file) string {
+	encodings := make([]string, 0, len(available))
+	for _, precompressed := range precompressedExtensions {
+		if _, ok := available[precompressed.encoding]; ok {
+			encodings = append(encodings, precompressed.encoding)
+		}
+	}
+	return oakmux.NegotiateContentEncoding(header, encodings...)
+}
+
 func (fs *FS) ServeHTTP(
 	w http.ResponseWriter,
 	r *http.Request,
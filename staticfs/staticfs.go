@@ -1,26 +1,78 @@
 /*
-Package staticfs adapts [http.FS] to [oakmux.Handler] signature.
+Package staticfs serves files from an [fs.FS] using [oakmux.Handler] signature.
+
+Mounted under a terminal route, like "assets/[...path]", files are resolved from the terminal segment using [oakmux.RoutingContext.Tail], so the index does not carry the route prefix. See [oakmux.WithRouteFileSystem].
+
+Files are hashed while indexing to produce strong ETags. Sibling files with .br or .gz extensions are served in place of the original, when the client accepts the corresponding content encoding.
+
+Several file systems can be stacked with [WithLayer], so that a directory overrides individual files embedded in the binary.
+
+The index is built once. During development, [FS.Watch] polls the file system and swaps in a fresh index when files change, while [FS.ServeReloadEvents] tells browsers to reload.
 */
 package staticfs
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
-	"net/http"
+	"log/slog"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 )
 
+// precompressedExtensions maps sibling file extensions to content encodings in the order of preference.
+var precompressedExtensions = []struct {
+	extension string
+	encoding  string
+}{
+	{extension: ".br", encoding: "br"},
+	{extension: ".gz", encoding: "gzip"},
+}
+
+type file struct {
+	path         string
+	layer        *layer
+	etag         string
+	size         int64
+	cacheControl string
+	encodings    map[string]*file
+}
+
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
+// snapshot is an immutable view of the indexed file system. It is replaced as a whole when the file system is reloaded.
+type snapshot struct {
+	index       map[string]*file
+	manifest    map[string]string
+	redirects   map[string]string
+	aliases     map[string]string
+	directories map[string]*directory
+	fallback    *file
+	notFound    *file
+	scan        *scanned // kept for updates of the writable directory
+	exclusions  []Exclusion
+	replaced    chan struct{} // closed when a newer snapshot takes over
+}
+
 type FS struct {
-	index  map[string]string
-	source http.Handler
+	current  atomic.Pointer[snapshot]
+	options  *options
+	reloadMu sync.Mutex
+	writeMu  sync.Mutex // serializes changes to the writable directory
 }
 
 func New(withOptions ...Option) (_ *FS, err error) {
 	o := &options{Index: make(map[string]string)}
 	for _, option := range append(
 		withOptions,
-		func(o *options) error { // populate index
-			if o.FileSystem == nil {
+		func(o *options) error { // validate
+			if len(o.Layers) == 0 {
 				return errors.New("file system is required")
 			}
 			if len(o.Translators) == 0 {
@@ -32,34 +84,8 @@ func New(withOptions ...Option) (_ *FS, err error) {
 					return err
 				}
 			}
-
-			if err = fs.WalkDir(o.FileSystem, ".",
-				func(path string, d fs.DirEntry, err error) error {
-					if err != nil {
-						return err
-					}
-					if d.IsDir() {
-						return nil // skip directories
-					}
-
-					external := path
-					accept := false
-					for _, translator := range o.Translators {
-						external, accept, err = translator(external)
-						if err != nil {
-							return err
-						}
-						if !accept {
-							return nil // skip, choice of the translator
-						}
-						if err = WithPath(external, path)(o); err != nil {
-							return err
-						}
-					}
-					return nil
-				},
-			); err != nil {
-				return fmt.Errorf("cannot index files from the file system: %w", err)
+			if len(o.IndexNames) == 0 {
+				o.IndexNames = defaultIndexNames
 			}
 			return nil
 		},
@@ -69,12 +95,386 @@ func New(withOptions ...Option) (_ *FS, err error) {
 		}
 	}
 
-	return &FS{
-		index:  o.Index,
-		source: http.FileServer(http.FS(o.FileSystem)),
-	}, nil
+	s, err := o.build()
+	if err != nil {
+		return nil, fmt.Errorf("cannot create static file system: %w", err)
+	}
+	result := &FS{
+		options: o,
+	}
+	result.current.Store(s)
+	if len(s.exclusions) > 0 {
+		report := make([]string, len(s.exclusions))
+		for i, exclusion := range result.Exclusions() {
+			report[i] = exclusion.String()
+		}
+		slog.Info(
+			"some files were left out of the static file system",
+			slog.Int("count", len(report)),
+			slog.Any("exclusions", report),
+		)
+	}
+	return result, nil
+}
+
+// scanned is the result of walking the file system layers.
+type scanned struct {
+	layers     []map[string]string // external to real paths published by each layer
+	index      map[string]source
+	aliases    map[string]string
+	exclusions []Exclusion
+}
+
+// scan walks every layer and maps the external paths accepted by the translators to real files, in addition to the paths set using [WithPath]. Higher layers shadow the external paths of the lower ones.
+func (o *options) scan() (*scanned, error) {
+	result := &scanned{layers: make([]map[string]string, len(o.Layers))}
+	for i, l := range o.Layers {
+		result.layers[i] = make(map[string]string)
+		if err := o.walk(result, i, "."); err != nil {
+			return nil, fmt.Errorf("cannot index files from the %q layer: %w", l, err)
+		}
+	}
+	if err := o.merge(result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// translate maps the real path through the translators to its external path. A path rejected by any translator is not published.
+func (o *options) translate(real string) (external string, accept bool, err error) {
+	external = real
+	for _, translator := range o.Translators {
+		if external, accept, err = translator(external); err != nil || !accept {
+			return "", false, err
+		}
+	}
+	return external, true, nil
+}
+
+// walk publishes the files of the layer found under the root into the scan result.
+func (o *options) walk(result *scanned, layerIndex int, root string) error {
+	l, published := o.Layers[layerIndex], result.layers[layerIndex]
+	return fs.WalkDir(l.fileSystem, root,
+		func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			reason, err := o.filter(l.fileSystem, path, d)
+			if err != nil {
+				return err
+			}
+			if reason != "" {
+				result.exclusions = append(result.exclusions, Exclusion{
+					Path:   path,
+					Layer:  l.name,
+					Reason: reason,
+				})
+				if d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				return nil // skip directories
+			}
+
+			external, accept, err := o.translate(path)
+			if err != nil {
+				return err
+			}
+			if !accept {
+				return nil // skip, choice of the translator
+			}
+			if current, ok := published[external]; ok {
+				return fmt.Errorf("request path %q already points to %q", external, current)
+			}
+			published[external] = path
+			return nil
+		},
+	)
+}
+
+// merge stacks the files published by the layers on top of the paths set using [WithPath] and derives the aliases.
+func (o *options) merge(result *scanned) error {
+	result.index = make(map[string]source, len(o.Index))
+	result.aliases = make(map[string]string, len(o.Aliases))
+	index := result.index
+	for external, real := range o.Index {
+		l, err := o.resolve(real)
+		if err != nil {
+			return err
+		}
+		index[external] = source{real: real, layer: l}
+	}
+	for alias, canonical := range o.Aliases {
+		result.aliases[alias] = canonical
+	}
+	for i, l := range o.Layers {
+		for external, real := range result.layers[i] {
+			if untranslated := "/" + real; o.Canonical && untranslated != external {
+				if _, ok := result.aliases[untranslated]; !ok {
+					result.aliases[untranslated] = external
+				}
+			}
+			if _, ok := index[external]; ok {
+				continue // shadowed by a higher layer
+			}
+			index[external] = source{real: real, layer: l}
+		}
+	}
+
+	for alias, canonical := range result.aliases {
+		if _, ok := index[alias]; ok {
+			if _, isExplicit := o.Aliases[alias]; isExplicit {
+				return fmt.Errorf("alias %q is already a published path", alias)
+			}
+			delete(result.aliases, alias) // another file is published there
+			continue
+		}
+		if _, ok := index[canonical]; !ok {
+			return fmt.Errorf("alias %q points to %q, which is not published", alias, canonical)
+		}
+	}
+	return nil
+}
+
+// build scans and hashes the file system into a new [snapshot].
+func (o *options) build() (s *snapshot, err error) {
+	scan, err := o.scan()
+	if err != nil {
+		return nil, err
+	}
+	return o.assemble(scan, nil)
+}
+
+// assemble hashes the scanned files into a new [snapshot]. Files found in the reusable map are carried over without reading them again.
+func (o *options) assemble(scan *scanned, reusable map[source]*file) (s *snapshot, err error) {
+	index, err := buildIndex(o, scan.index, reusable)
+	if err != nil {
+		return nil, err
+	}
+	s = &snapshot{
+		index:      index,
+		scan:       scan,
+		exclusions: scan.exclusions,
+		replaced:   make(chan struct{}),
+	}
+	if o.Fallback != "" {
+		if s.fallback, err = s.lookup(o.Fallback); err != nil {
+			return nil, fmt.Errorf("cannot use fallback file: %w", err)
+		}
+	}
+	if o.NotFound != "" {
+		if s.notFound, err = s.lookup(o.NotFound); err != nil {
+			return nil, fmt.Errorf("cannot use not found page: %w", err)
+		}
+	}
+	logical := s.index
+	if o.Fingerprint {
+		s.fingerprint(o.Redirect)
+	}
+	if len(scan.aliases) > 0 {
+		s.aliases = make(map[string]string, len(scan.aliases))
+		for alias, canonical := range scan.aliases {
+			if fingerprinted, ok := s.manifest[canonical]; ok {
+				canonical = fingerprinted
+			}
+			s.aliases[alias] = canonical
+		}
+	}
+	s.directories = buildDirectories(logical, s.index, o.IndexNames, o.Listing)
+	return s, nil
+}
+
+// lookup finds a file by its logical name.
+func (s *snapshot) lookup(name string) (*file, error) {
+	if !strings.HasPrefix(name, "/") {
+		name = "/" + name
+	}
+	f, ok := s.index[name]
+	if !ok {
+		return nil, fmt.Errorf("file %q is not in the static file system", name)
+	}
+	return f, nil
+}
+
+// fingerprintPath inserts the hash before the extension of the external path.
+func fingerprintPath(external, etag string) string {
+	hash := strings.Trim(etag, `"`)[:8]
+	extension := path.Ext(external)
+	if extension == "" || strings.HasSuffix(external, "/"+extension) {
+		return external + "." + hash // no extension or a dot file
+	}
+	return strings.TrimSuffix(external, extension) + "." + hash + extension
+}
+
+// fingerprint moves every file to its fingerprinted path and records the original path in the manifest.
+func (s *snapshot) fingerprint(redirect bool) {
+	index := make(map[string]*file, len(s.index))
+	s.manifest = make(map[string]string, len(s.index))
+	if redirect {
+		s.redirects = make(map[string]string, len(s.index))
+	}
+	for external, f := range s.index {
+		fingerprinted := fingerprintPath(external, f.etag)
+		index[fingerprinted] = f
+		s.manifest[external] = fingerprinted
+		if redirect {
+			s.redirects[external] = fingerprinted
+		}
+		if f.cacheControl == "" {
+			f.cacheControl = immutableCacheControl
+		}
+	}
+	s.index = index
+}
+
+// URL resolves the logical name of a file, like "app.js", to its external path. With [WithFingerprints], the path contains the content hash.
+func (fs *FS) URL(name string) (string, error) {
+	if !strings.HasPrefix(name, "/") {
+		name = "/" + name
+	}
+	s := fs.current.Load()
+	if s.manifest != nil {
+		if fingerprinted, ok := s.manifest[name]; ok {
+			return fingerprinted, nil
+		}
+	} else if _, ok := s.index[name]; ok {
+		return name, nil
+	}
+	return "", fmt.Errorf("file %q is not in the static file system", name)
+}
+
+// Manifest returns a copy of logical to external path mapping.
+func (fs *FS) Manifest() map[string]string {
+	s := fs.current.Load()
+	manifest := make(map[string]string, len(s.index))
+	if s.manifest != nil {
+		for logical, external := range s.manifest {
+			manifest[logical] = external
+		}
+		return manifest
+	}
+	for external := range s.index {
+		manifest[external] = external
+	}
+	return manifest
+}
+
+// TemplateFuncs provides the "asset" template function that resolves logical file names using [FS.URL]. The result can be passed to Funcs method of both [html/template.Template] and [text/template.Template].
+func (fs *FS) TemplateFuncs() map[string]any {
+	return map[string]any{
+		"asset": fs.URL,
+	}
+}
+
+// buildIndex hashes every published file and attaches precompressed siblings from the same layer, which pass the same filters, and cache policies. Reusable files are complete and are not modified.
+func buildIndex(o *options, paths map[string]source, reusable map[source]*file) (map[string]*file, error) {
+	hashed := make(map[source]*file, len(paths))
+	load := func(src source) (*file, error) {
+		if f, ok := hashed[src]; ok {
+			return f, nil
+		}
+		if f, ok := reusable[src]; ok {
+			hashed[src] = f
+			return f, nil
+		}
+		etag, size, err := hashFile(src.layer.fileSystem, src.real)
+		if err != nil {
+			return nil, err
+		}
+		f := &file{path: src.real, layer: src.layer, etag: etag, size: size}
+		hashed[src] = f
+		return f, nil
+	}
+
+	index := make(map[string]*file, len(paths))
+	published := make(map[*file]struct{}, len(paths))
+	for external, src := range paths {
+		f, err := load(src)
+		if err != nil {
+			return nil, fmt.Errorf("cannot hash file %q: %w", src.real, err)
+		}
+		index[external] = f
+		if _, ok := reusable[src]; !ok {
+			published[f] = struct{}{}
+		}
+	}
+
+	for f := range published {
+		f.cacheControl = o.cacheControl(f.path)
+		for _, precompressed := range precompressedExtensions {
+			variant := source{real: f.path + precompressed.extension, layer: f.layer}
+			info, err := fs.Stat(variant.layer.fileSystem, variant.real)
+			if err != nil || info.IsDir() {
+				continue
+			}
+			reason, err := o.filter(variant.layer.fileSystem, variant.real, fs.FileInfoToDirEntry(info))
+			if err != nil {
+				return nil, fmt.Errorf("cannot filter file %q: %w", variant.real, err)
+			}
+			if reason != "" {
+				continue // the filters withhold the variant just like any other file
+			}
+			compressed, err := load(variant)
+			if err != nil {
+				return nil, fmt.Errorf("cannot hash file %q: %w", variant.real, err)
+			}
+			if f.encodings == nil {
+				f.encodings = make(map[string]*file)
+			}
+			f.encodings[precompressed.encoding] = compressed
+		}
+	}
+	return index, nil
+}
+
+// hashFile computes a strong entity tag and the size from the file contents.
+func hashFile(fileSystem fs.FS, name string) (string, int64, error) {
+	handle, err := fileSystem.Open(name)
+	if err != nil {
+		return "", 0, err
+	}
+	defer handle.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, handle)
+	if err != nil {
+		return "", 0, err
+	}
+	return `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`, size, nil
 }
 
 func (fs *FS) String() string {
-	return fmt.Sprintf("%+v", fs.index)
+	b := &strings.Builder{}
+	s := fs.current.Load()
+	b.WriteString("map[")
+	for i, external := range sortedKeys(s.index) {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		f := s.index[external]
+		fmt.Fprintf(b, "%s:%s", external, f.path)
+		if len(fs.options.Layers) > 1 {
+			fmt.Fprintf(b, "@%s", f.layer)
+		}
+	}
+	b.WriteString("]")
+	return b.String()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func matchPattern(pattern, name string) bool {
+	if !strings.Contains(pattern, "/") {
+		name = path.Base(name)
+	}
+	ok, _ := path.Match(pattern, name)
+	return ok
 }
@@ -0,0 +1,855 @@
+package staticfs
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/dkotik/oakmux"
+)
+
+func serve(t *testing.T, handler *FS, r *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	if err := handler.ServeHyperText(w, r); err != nil {
+		t.Fatalf("request to %q failed: %v", r.URL.Path, err)
+	}
+	return w
+}
+
+func TestCachingHeaders(t *testing.T) {
+	handler, err := New(
+		WithFileSystem(fstest.MapFS{
+			"app.js":     {Data: []byte("console.log('app')")},
+			"app.js.gz":  {Data: []byte("gzipped app")},
+			"app.js.br":  {Data: []byte("brotli app")},
+			"index.html": {Data: []byte("<html></html>")},
+		}),
+		WithCacheControl("*.js", "public, max-age=31536000, immutable"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := serve(t, handler, httptest.NewRequest(http.MethodGet, "/app.js", nil))
+	etag := w.Header().Get("ETag")
+	if len(etag) != 34 || w.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("unexpected identity response headers: %+v", w.Header())
+	}
+	if w.Header().Get("Cache-Control") != "public, max-age=31536000, immutable" {
+		t.Fatalf("cache control policy was not applied: %q", w.Header().Get("Cache-Control"))
+	}
+	if w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("Vary header is missing: %+v", w.Header())
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/app.js", nil)
+	r.Header.Set("If-None-Match", etag)
+	if w = serve(t, handler, r); w.Code != http.StatusNotModified {
+		t.Fatalf("fresh copy was answered with status %d", w.Code)
+	}
+
+	for accept, expected := range map[string]string{
+		"gzip":              "gzipped app",
+		"gzip, br":          "brotli app",
+		"br;q=0.5, gzip":    "gzipped app",
+		"br;q=0, gzip;q=0":  "console.log('app')",
+		"deflate, identity": "console.log('app')",
+	} {
+		r = httptest.NewRequest(http.MethodGet, "/app.js", nil)
+		r.Header.Set("Accept-Encoding", accept)
+		w = serve(t, handler, r)
+		if w.Body.String() != expected {
+			t.Fatalf("Accept-Encoding %q served %q instead of %q", accept, w.Body.String(), expected)
+		}
+		if expected != "console.log('app')" && w.Header().Get("ETag") == etag {
+			t.Fatalf("Accept-Encoding %q served a compressed variant under the identity ETag", accept)
+		}
+		if contentType := w.Header().Get("Content-Type"); contentType != "text/javascript; charset=utf-8" {
+			t.Fatalf("Accept-Encoding %q served content type %q", accept, contentType)
+		}
+	}
+
+	w = serve(t, handler, httptest.NewRequest(http.MethodGet, "/index.html", nil))
+	if w.Header().Get("Cache-Control") != "" || w.Header().Get("Vary") != "" {
+		t.Fatalf("unexpected headers for a file without policies: %+v", w.Header())
+	}
+}
+
+func TestFingerprints(t *testing.T) {
+	handler, err := New(
+		WithFileSystem(fstest.MapFS{
+			"app.js":        {Data: []byte("console.log('app')")},
+			"css/style.css": {Data: []byte("body{}")},
+			"LICENSE":       {Data: []byte("MIT")},
+		}),
+		WithFingerprintRedirects(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	external, err := handler.URL("app.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^/app\.[0-9a-f]{8}\.js$`).MatchString(external) {
+		t.Fatalf("unexpected fingerprinted path: %q", external)
+	}
+	if license, _ := handler.URL("/LICENSE"); !regexp.MustCompile(`^/LICENSE\.[0-9a-f]{8}$`).MatchString(license) {
+		t.Fatalf("unexpected fingerprinted path: %q", license)
+	}
+	if _, err = handler.URL("missing.js"); err == nil {
+		t.Fatal("missing file was resolved")
+	}
+
+	w := serve(t, handler, httptest.NewRequest(http.MethodGet, external, nil))
+	if w.Body.String() != "console.log('app')" || w.Header().Get("Cache-Control") != immutableCacheControl {
+		t.Fatalf("unexpected fingerprinted response: %q %+v", w.Body.String(), w.Header())
+	}
+	w = serve(t, handler, httptest.NewRequest(http.MethodGet, "/app.js?v=1", nil))
+	if w.Code != http.StatusTemporaryRedirect || w.Header().Get("Location") != external+"?v=1" {
+		t.Fatalf("original path was not redirected: %d %q", w.Code, w.Header().Get("Location"))
+	}
+
+	tmpl, err := template.New("page").Funcs(handler.TemplateFuncs()).Parse(`<link href="{{ asset "css/style.css" }}">`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &strings.Builder{}
+	if err = tmpl.Execute(b, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^<link href="/css/style\.[0-9a-f]{8}\.css">$`).MatchString(b.String()) {
+		t.Fatalf("unexpected template output: %q", b.String())
+	}
+}
+
+func TestFallbackAndNotFoundPage(t *testing.T) {
+	handler, err := New(
+		WithFileSystem(fstest.MapFS{
+			"index.html": {Data: []byte("<html>app</html>")},
+			"404.html":   {Data: []byte("<html>missing</html>")},
+			"app.js":     {Data: []byte("console.log('app')")},
+		}),
+		WithFallback("index.html"),
+		WithNotFoundPage("/404.html"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	navigation := func(p, accept string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, p, nil)
+		r.Header.Set("Accept", accept)
+		return r
+	}
+
+	cases := []struct {
+		request *http.Request
+		status  int
+		body    string
+	}{
+		{request: navigation("/orders/12", "text/html,application/xhtml+xml"), status: http.StatusOK, body: "<html>app</html>"},
+		{request: navigation("/orders/12", "application/json"), status: http.StatusNotFound, body: "<html>missing</html>"},
+		{request: navigation("/missing.js", "text/html"), status: http.StatusNotFound, body: "<html>missing</html>"},
+		{request: navigation("/app.js", "*/*"), status: http.StatusOK, body: "console.log('app')"},
+	}
+	for _, c := range cases {
+		w := serve(t, handler, c.request)
+		if w.Code != c.status || w.Body.String() != c.body {
+			t.Fatalf("%s returned %d %q instead of %d %q", c.request.URL.Path, w.Code, w.Body.String(), c.status, c.body)
+		}
+		if c.status == http.StatusNotFound && w.Header().Get("Cache-Control") != "no-store" {
+			t.Fatalf("not found page is cacheable: %+v", w.Header())
+		}
+	}
+
+	if _, err = New(
+		WithFileSystem(fstest.MapFS{"app.js": {}}),
+		WithFallback("index.html"),
+	); err == nil {
+		t.Fatal("missing fallback file was accepted")
+	}
+}
+
+func TestDirectoryIndexAndListing(t *testing.T) {
+	handler, err := New(
+		WithFileSystem(fstest.MapFS{
+			"index.html":           {Data: []byte("home")},
+			"docs/index.htm":       {Data: []byte("legacy docs")},
+			"docs/index.html":      {Data: []byte("docs")},
+			"assets/app.js":        {Data: []byte("app")},
+			"assets/fonts/a.woff2": {Data: []byte("font")},
+			"assets/secret.txt":    {Data: []byte("hidden")},
+		}),
+		WithPathTranslators(func(real string) (string, bool, error) {
+			return "/" + real, !strings.HasSuffix(real, ".txt"), nil
+		}),
+		WithIndexNames("index.html", "index.htm"),
+		WithDirectoryListing(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for requestPath, expected := range map[string]string{
+		"/":      "home",
+		"/docs/": "docs",
+	} {
+		w := serve(t, handler, httptest.NewRequest(http.MethodGet, requestPath, nil))
+		if w.Code != http.StatusOK || w.Body.String() != expected {
+			t.Fatalf("directory %q resolved to %d %q", requestPath, w.Code, w.Body.String())
+		}
+	}
+
+	for requestPath, expected := range map[string]string{
+		"/docs?v=1":       "/docs/?v=1",
+		"/assets":         "/assets/",
+		"/assets/app.js/": "/assets/app.js",
+	} {
+		w := serve(t, handler, httptest.NewRequest(http.MethodGet, requestPath, nil))
+		if w.Code != http.StatusTemporaryRedirect || w.Header().Get("Location") != expected {
+			t.Fatalf("path %q redirected with %d to %q", requestPath, w.Code, w.Header().Get("Location"))
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/assets/", nil)
+	r.Header.Set("Accept", "application/json")
+	w := serve(t, handler, r)
+	if w.Header().Get("Content-Type") != "application/json; charset=utf-8" {
+		t.Fatalf("unexpected listing content type: %q", w.Header().Get("Content-Type"))
+	}
+	if listing := strings.TrimSpace(w.Body.String()); listing != `[{"name":"fonts","path":"/assets/fonts/","directory":true},{"name":"app.js","path":"/assets/app.js","size":3}]` {
+		t.Fatalf("unexpected JSON listing: %s", listing)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/assets/", nil)
+	r.Header.Set("Accept", "text/html")
+	w = serve(t, handler, r)
+	if !strings.Contains(w.Body.String(), `<a href="/assets/app.js">app.js</a>`) || strings.Contains(w.Body.String(), "secret") {
+		t.Fatalf("unexpected HTML listing: %s", w.Body.String())
+	}
+
+	withoutListing, err := New(WithFileSystem(fstest.MapFS{
+		"assets/app.js": {Data: []byte("app")},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = withoutListing.ServeHyperText(
+		httptest.NewRecorder(),
+		httptest.NewRequest(http.MethodGet, "/assets/", nil),
+	); err != ErrNotFound {
+		t.Fatalf("directory was listed without opting in: %v", err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	mapFS := fstest.MapFS{
+		"index.html": {Data: []byte("first")},
+	}
+	handler, err := New(WithFileSystem(mapFS))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := handler.ServeReloadEvents(w, r); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer server.Close()
+	response, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	events := bufio.NewReader(response.Body)
+	if line, err := events.ReadString('\n'); err != nil || line != ": watching\n" {
+		t.Fatalf("reload event stream did not open: %q %v", line, err)
+	}
+
+	mapFS["index.html"] = &fstest.MapFile{Data: []byte("second")}
+	mapFS["new.txt"] = &fstest.MapFile{Data: []byte("new")}
+	if err = handler.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if w := serve(t, handler, httptest.NewRequest(http.MethodGet, "/new.txt", nil)); w.Body.String() != "new" {
+		t.Fatalf("added file was not served: %q", w.Body.String())
+	}
+	if w := serve(t, handler, httptest.NewRequest(http.MethodGet, "/", nil)); w.Body.String() != "second" {
+		t.Fatalf("modified file was not served: %q", w.Body.String())
+	}
+	for _, expected := range []string{"\n", "event: reload\n", "data: reload\n"} {
+		if line, err := events.ReadString('\n'); err != nil || line != expected {
+			t.Fatalf("expected reload event line %q, got %q %v", expected, line, err)
+		}
+	}
+
+	delete(mapFS, "new.txt")
+	if err = handler.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if err = handler.ServeHyperText(
+		httptest.NewRecorder(),
+		httptest.NewRequest(http.MethodGet, "/new.txt", nil),
+	); err != ErrNotFound {
+		t.Fatalf("removed file is still served: %v", err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	directory := t.TempDir()
+	if err := os.WriteFile(filepath.Join(directory, "a.txt"), []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	handler, err := New(WithDirectory(directory))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go handler.Watch(ctx, time.Millisecond*5)
+
+	time.Sleep(time.Millisecond * 20)
+	if err = os.WriteFile(filepath.Join(directory, "b.txt"), []byte("b"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second * 2)
+	for !strings.Contains(handler.String(), "/b.txt") {
+		if time.Now().After(deadline) {
+			t.Fatalf("new file was not picked up: %s", handler.String())
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+}
+
+func TestServeContent(t *testing.T) {
+	handler, err := New(
+		WithFileSystem(fstest.MapFS{
+			"app.mjs":          {Data: []byte("export default 1")},
+			"site.webmanifest": {Data: []byte("{}")},
+			"data.bin":         {Data: []byte("0123456789")},
+		}),
+		WithContentType(".MJS", "text/javascript; charset=utf-8"),
+		WithContentType(".webmanifest", "application/manifest+json"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for requestPath, expected := range map[string]string{
+		"/app.mjs":          "text/javascript; charset=utf-8",
+		"/site.webmanifest": "application/manifest+json",
+	} {
+		r := httptest.NewRequest(http.MethodGet, requestPath, nil)
+		w := serve(t, handler, r)
+		if w.Header().Get("Content-Type") != expected {
+			t.Fatalf("%q served as %q", requestPath, w.Header().Get("Content-Type"))
+		}
+		if w.Header().Get("X-Content-Type-Options") != "nosniff" {
+			t.Fatalf("%q is missing the no sniff header", requestPath)
+		}
+		if r.URL.Path != requestPath {
+			t.Fatalf("request path was changed to %q", r.URL.Path)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/data.bin", nil)
+	r.Header.Set("Range", "bytes=2-5")
+	w := serve(t, handler, r)
+	if w.Code != http.StatusPartialContent || w.Body.String() != "2345" {
+		t.Fatalf("range request returned %d %q", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Content-Range") != "bytes 2-5/10" {
+		t.Fatalf("unexpected content range: %q", w.Header().Get("Content-Range"))
+	}
+
+	if _, err = New(
+		WithFileSystem(fstest.MapFS{}),
+		WithContentType("mjs", "text/javascript"),
+	); err == nil {
+		t.Fatal("extension without a dot was accepted")
+	}
+}
+
+func TestMountedUnderMux(t *testing.T) {
+	handler, err := New(
+		WithFileSystem(fstest.MapFS{
+			"index.html":      {Data: []byte("home")},
+			"docs/index.html": {Data: []byte("docs")},
+			"css/app.css":     {Data: []byte("body{}")},
+		}),
+		WithFingerprintRedirects(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux, err := oakmux.New(
+		oakmux.WithRouteFileSystem("assets", "/assets/", handler),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprinted, err := handler.URL("css/app.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for requestPath, expected := range map[string]string{
+		"/assets/":                "home",
+		"/assets/docs/":           "docs",
+		"/assets" + fingerprinted: "body{}",
+	} {
+		r := httptest.NewRequest(http.MethodGet, requestPath, nil)
+		w := httptest.NewRecorder()
+		if err = mux.ServeHyperText(w, r); err != nil {
+			t.Fatalf("request to %q failed: %v", requestPath, err)
+		}
+		if w.Code != http.StatusOK || w.Body.String() != expected {
+			t.Fatalf("mounted path %q resolved to %d %q", requestPath, w.Code, w.Body.String())
+		}
+		if r.URL.Path != requestPath {
+			t.Fatalf("request path was changed to %q", r.URL.Path)
+		}
+	}
+
+	for requestPath, expected := range map[string]string{
+		"/assets/css/app.css": "/assets" + fingerprinted,
+		"/assets/docs":        "/assets/docs/",
+	} {
+		w := httptest.NewRecorder()
+		if err = mux.ServeHyperText(w, httptest.NewRequest(http.MethodGet, requestPath, nil)); err != nil {
+			t.Fatalf("request to %q failed: %v", requestPath, err)
+		}
+		if w.Code != http.StatusTemporaryRedirect || w.Header().Get("Location") != expected {
+			t.Fatalf("mounted path %q redirected with %d to %q", requestPath, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
+
+func TestLayers(t *testing.T) {
+	handler, err := New(
+		WithFileSystem(fstest.MapFS{
+			"app.css":    {Data: []byte("embedded css")},
+			"app.css.gz": {Data: []byte("embedded gzipped css")},
+			"logo.svg":   {Data: []byte("embedded logo")},
+		}),
+		WithLayer("theme", fstest.MapFS{
+			"logo.svg": {Data: []byte("theme logo")},
+		}),
+		WithLayer("operator", fstest.MapFS{
+			"app.css":  {Data: []byte("operator css")},
+			"extra.js": {Data: []byte("operator script")},
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for requestPath, expected := range map[string]string{
+		"/app.css":  "operator css",
+		"/logo.svg": "theme logo",
+		"/extra.js": "operator script",
+	} {
+		r := httptest.NewRequest(http.MethodGet, requestPath, nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		if w := serve(t, handler, r); w.Body.String() != expected {
+			t.Fatalf("%q was served from the wrong layer: %q", requestPath, w.Body.String())
+		}
+	}
+	if w := serve(t, handler, httptest.NewRequest(http.MethodGet, "/app.css.gz", nil)); w.Body.String() != "embedded gzipped css" {
+		t.Fatalf("lower layer file was not published: %q", w.Body.String())
+	}
+
+	if report := handler.String(); report != "map[/app.css:app.css@operator /app.css.gz:app.css.gz@base /extra.js:extra.js@operator /logo.svg:logo.svg@theme]" {
+		t.Fatalf("unexpected layer report: %s", report)
+	}
+
+	if _, err = New(
+		WithFileSystem(fstest.MapFS{}),
+		WithLayer("a", fstest.MapFS{}),
+		WithLayer("a", fstest.MapFS{}),
+	); err == nil {
+		t.Fatal("duplicate layer name was accepted")
+	}
+}
+
+func TestFilters(t *testing.T) {
+	handler, err := New(
+		WithFileSystem(fstest.MapFS{
+			".env":                     {Data: []byte("SECRET=1")},
+			".git/config":              {Data: []byte("[core]")},
+			".well-known/security.txt": {Data: []byte("contact")},
+			"index.html":               {Data: []byte("home")},
+			"drafts/post.html":         {Data: []byte("draft")},
+			"notes.md":                 {Data: []byte("notes")},
+			"video.html":               {Data: []byte(strings.Repeat("v", 100))},
+			"assets/app.js":            {Data: []byte("app")},
+			"assets/app.js.map":        {Data: []byte("map")},
+		}),
+		WithInclude("*.html", "*.js", "*.txt"),
+		WithExclude("drafts", "*.map"),
+		WithMaximumFileSizeOf(64),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if published := handler.String(); published != "map[/.well-known/security.txt:.well-known/security.txt /assets/app.js:assets/app.js /index.html:index.html]" {
+		t.Fatalf("unexpected published files: %s", published)
+	}
+	report := make([]string, 0)
+	for _, exclusion := range handler.Exclusions() {
+		report = append(report, exclusion.String())
+	}
+	if strings.Join(report, "\n") != strings.Join([]string{
+		".env@base: hidden",
+		".git@base: hidden",
+		"assets/app.js.map@base: excluded by pattern *.map",
+		"drafts@base: excluded by pattern drafts",
+		"notes.md@base: not included by any pattern",
+		"video.html@base: size of 100 bytes exceeds the limit of 64",
+	}, "\n") {
+		t.Fatalf("unexpected exclusion report:\n%s", strings.Join(report, "\n"))
+	}
+
+	withHidden, err := New(
+		WithFileSystem(fstest.MapFS{".env": {Data: []byte("SECRET=1")}}),
+		WithHiddenFiles(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if published := withHidden.String(); published != "map[/.env:.env]" {
+		t.Fatalf("hidden file was not published: %s", published)
+	}
+
+	withoutVariants, err := New(
+		WithFileSystem(fstest.MapFS{
+			"app.js":    {Data: []byte("app")},
+			"app.js.gz": {Data: []byte("gzipped app")},
+			"app.js.br": {Data: []byte(strings.Repeat("b", 100))},
+		}),
+		WithExclude("*.gz"),
+		WithMaximumFileSizeOf(64),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/app.js", nil)
+	r.Header.Set("Accept-Encoding", "gzip, br")
+	if w := serve(t, withoutVariants, r); w.Body.String() != "app" || w.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("filtered precompressed variant was served: %q", w.Body.String())
+	}
+}
+
+func TestTranslatorsAndCanonicalRedirects(t *testing.T) {
+	handler, err := New(
+		WithFileSystem(fstest.MapFS{
+			"public/index.html":     {Data: []byte("home")},
+			"public/About.html":     {Data: []byte("about")},
+			"public/docs/index.htm": {Data: []byte("docs")},
+			"public/old-logo.svg":   {Data: []byte("logo")},
+			"build.sh":              {Data: []byte("#!/bin/sh")},
+		}),
+		WithPathTranslators(
+			StripDirectory("public"),
+			Lowercase(),
+			StripHTMLExtension(),
+			Rename(map[string]string{"old-logo.svg": "logo.svg"}),
+			AddPrefix("site"),
+		),
+		WithIndexNames("index.html", "index.htm"),
+		WithCanonicalRedirects(),
+		WithAlias("/site/about-us", "/site/about"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if published := handler.String(); published != "map[/site/about:public/About.html /site/docs/index:public/docs/index.htm /site/index:public/index.html /site/logo.svg:public/old-logo.svg]" {
+		t.Fatalf("unexpected published files: %s", published)
+	}
+
+	for requestPath, expected := range map[string]string{
+		"/site/":      "home",
+		"/site/about": "about",
+		"/site/docs/": "docs",
+	} {
+		w := serve(t, handler, httptest.NewRequest(http.MethodGet, requestPath, nil))
+		if w.Code != http.StatusOK || w.Body.String() != expected {
+			t.Fatalf("%q resolved to %d %q", requestPath, w.Code, w.Body.String())
+		}
+	}
+
+	for requestPath, expected := range map[string]string{
+		"/public/About.html?ref=1": "/site/about?ref=1",
+		"/site/about-us":           "/site/about",
+		"/public/old-logo.svg":     "/site/logo.svg",
+	} {
+		w := serve(t, handler, httptest.NewRequest(http.MethodGet, requestPath, nil))
+		if w.Code != http.StatusPermanentRedirect || w.Header().Get("Location") != expected {
+			t.Fatalf("%q redirected with %d to %q", requestPath, w.Code, w.Header().Get("Location"))
+		}
+	}
+
+	if _, err = New(
+		WithFileSystem(fstest.MapFS{"a.txt": {}}),
+		WithAlias("/b.txt", "/missing.txt"),
+	); err == nil {
+		t.Fatal("alias to a missing file was accepted")
+	}
+}
+
+func TestWritableDirectory(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	handler, err := New(
+		WithWritableDirectory(root),
+		WithMaximumFileSizeOf(16),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := func(method, target, body string) (*httptest.ResponseRecorder, error) {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		if body == "" {
+			r.ContentLength = 0
+		}
+		r.Header.Set("Depth", "1")
+		w := httptest.NewRecorder()
+		return w, handler.ServeHyperText(w, r)
+	}
+	expectStatus := func(method, target, body string, expected int) *httptest.ResponseRecorder {
+		t.Helper()
+		w, err := request(method, target, body)
+		code := w.Code
+		if err != nil {
+			var httpError interface{ HyperTextStatusCode() int }
+			if !errors.As(err, &httpError) {
+				t.Fatalf("%s %s failed: %v", method, target, err)
+			}
+			code = httpError.HyperTextStatusCode()
+		}
+		if code != expected {
+			t.Fatalf("%s %s returned status %d instead of %d: %v", method, target, code, expected, err)
+		}
+		return w
+	}
+
+	expectStatus(http.MethodPut, "/notes.txt", "first", http.StatusCreated)
+	expectStatus(http.MethodPut, "/notes.txt", "second", http.StatusNoContent)
+	if w := expectStatus(http.MethodGet, "/notes.txt", "", http.StatusOK); w.Body.String() != "second" {
+		t.Fatalf("uploaded file was not served: %q", w.Body.String())
+	}
+	expectStatus(http.MethodPut, "/missing/notes.txt", "x", http.StatusConflict)
+	expectStatus(http.MethodPut, "/.env", "SECRET=1", http.StatusForbidden)
+	expectStatus(http.MethodPut, "/escape/notes.txt", "x", http.StatusForbidden)
+	expectStatus(http.MethodPut, "/large.txt", strings.Repeat("x", 17), http.StatusRequestEntityTooLarge)
+	if _, err = os.Stat(filepath.Join(outside, "notes.txt")); err == nil {
+		t.Fatal("file was written outside of the writable directory")
+	}
+
+	expectStatus("MKCOL", "/docs/", "", http.StatusCreated)
+	expectStatus("MKCOL", "/docs/", "", http.StatusMethodNotAllowed)
+	expectStatus(http.MethodPut, "/docs/readme.txt", "read me", http.StatusCreated)
+
+	w := expectStatus("PROPFIND", "/docs/", "", http.StatusMultiStatus)
+	for _, expected := range []string{
+		"<D:href>/docs/</D:href>",
+		"<D:href>/docs/readme.txt</D:href>",
+		"<D:getcontentlength>7</D:getcontentlength>",
+		"<D:collection></D:collection>",
+	} {
+		if !strings.Contains(w.Body.String(), expected) {
+			t.Fatalf("PROPFIND response is missing %q:\n%s", expected, w.Body.String())
+		}
+	}
+
+	expectStatus(http.MethodDelete, "/docs/", "", http.StatusNoContent)
+	expectStatus(http.MethodGet, "/docs/readme.txt", "", http.StatusNotFound)
+	expectStatus(http.MethodDelete, "/docs/", "", http.StatusNotFound)
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), writableTemporaryPrefix) {
+			t.Fatalf("temporary upload file was left behind: %s", entry.Name())
+		}
+	}
+}
+
+func TestWritableDirectoryConsistency(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"about.html": "about",
+		"secret.key": "secret",
+		"index.html": "home",
+	} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	handler, err := New(
+		WithWritableDirectory(root),
+		WithExclude("*.key", "private"),
+		WithPathTranslators(StripHTMLExtension()),
+		WithAlias("/home", "/index"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectStatus := func(method, target, body string, expected int) {
+		t.Helper()
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		err := handler.ServeHyperText(w, r)
+		code := w.Code
+		var httpError interface{ HyperTextStatusCode() int }
+		if errors.As(err, &httpError) {
+			code = httpError.HyperTextStatusCode()
+		} else if err != nil {
+			code = http.StatusInternalServerError
+		}
+		if code != expected {
+			t.Fatalf("%s %s returned status %d instead of %d: %v", method, target, code, expected, err)
+		}
+	}
+	expectFile := func(name string, exists bool) {
+		t.Helper()
+		if _, err := os.Stat(filepath.Join(root, name)); (err == nil) != exists {
+			t.Fatalf("file %q exists: %t", name, !exists)
+		}
+	}
+
+	expectStatus(http.MethodPut, "/evil.key", "x", http.StatusForbidden)
+	expectFile("evil.key", false)
+	expectStatus(http.MethodDelete, "/secret.key", "", http.StatusForbidden)
+	expectFile("secret.key", true)
+	expectStatus("MKCOL", "/private/", "", http.StatusForbidden)
+	expectFile("private", false)
+
+	expectStatus(http.MethodPut, "/about", "collision", http.StatusConflict)
+	expectFile("about", false)
+	expectStatus(http.MethodPut, "/contact.html", "contact", http.StatusCreated)
+	expectStatus(http.MethodGet, "/contact", "", http.StatusOK)
+
+	expectStatus(http.MethodDelete, "/index.html", "", http.StatusInternalServerError)
+	expectFile("index.html", true)
+	expectStatus(http.MethodGet, "/home", "", http.StatusPermanentRedirect)
+	if err = handler.Reload(); err != nil {
+		t.Fatal("reverted change left the directory in a state that cannot be indexed:", err)
+	}
+}
+
+func TestWritableDirectoryUpdates(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "draft.bak"), []byte("draft"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	options := []Option{
+		WithFileSystem(fstest.MapFS{
+			"app.js":          {Data: []byte("base app")},
+			"docs/guide.html": {Data: []byte("guide")},
+		}),
+		WithWritableDirectory(root),
+		WithExclude("*.bak"),
+		WithPathTranslators(StripHTMLExtension()),
+		WithCanonicalRedirects(),
+		WithDirectoryListing(),
+	}
+	handler, err := New(options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := func(method, target, body string) {
+		t.Helper()
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		if body == "" {
+			r.ContentLength = 0
+		}
+		if err := handler.ServeHyperText(httptest.NewRecorder(), r); err != nil {
+			t.Fatalf("%s %s failed: %v", method, target, err)
+		}
+	}
+	state := func(handler *FS) string {
+		report := []string{handler.String()}
+		for _, exclusion := range handler.Exclusions() {
+			report = append(report, exclusion.String())
+		}
+		for _, directory := range []string{"/", "/docs/"} {
+			r := httptest.NewRequest(http.MethodGet, directory, nil)
+			r.Header.Set("Accept", "application/json")
+			w := httptest.NewRecorder()
+			if err := handler.ServeHyperText(w, r); err == nil {
+				report = append(report, directory+" "+w.Body.String())
+			}
+		}
+		return strings.Join(report, "\n")
+	}
+	expectBody := func(target, accept, expected string) {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r.Header.Set("Accept-Encoding", accept)
+		if w := serve(t, handler, r); w.Body.String() != expected {
+			t.Fatalf("%s served %q instead of %q", target, w.Body.String(), expected)
+		}
+	}
+
+	for _, step := range []struct {
+		method string
+		target string
+		body   string
+		check  func()
+	}{
+		{method: http.MethodPut, target: "/app.js", body: "app", check: func() {
+			expectBody("/app.js", "", "app")
+		}},
+		{method: http.MethodPut, target: "/app.js.gz", body: "gzipped app", check: func() {
+			expectBody("/app.js", "gzip", "gzipped app")
+		}},
+		{method: "MKCOL", target: "/docs/"},
+		{method: http.MethodPut, target: "/docs/intro.html", body: "intro", check: func() {
+			expectBody("/docs/intro", "", "intro")
+		}},
+		{method: http.MethodDelete, target: "/app.js.gz", check: func() {
+			expectBody("/app.js", "gzip", "app")
+		}},
+		{method: http.MethodDelete, target: "/app.js", check: func() {
+			expectBody("/app.js", "", "base app")
+		}},
+		{method: http.MethodDelete, target: "/docs/"},
+	} {
+		request(step.method, step.target, step.body)
+		if step.check != nil {
+			step.check()
+		}
+		reference, err := New(options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated, reloaded := state(handler), state(reference); updated != reloaded {
+			t.Fatalf("%s %s updated the index to:\n%s\ninstead of:\n%s", step.method, step.target, updated, reloaded)
+		}
+	}
+	if !strings.Contains(state(handler), "draft.bak@writable: excluded by pattern *.bak") {
+		t.Fatal("exclusion of an untouched file was lost")
+	}
+}
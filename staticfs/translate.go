@@ -0,0 +1,93 @@
+package staticfs
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+func absolute(p string) string {
+	return "/" + strings.TrimPrefix(p, "/")
+}
+
+// StripExtensions publishes files without the given extensions, like "/about" for "about.html". Use with [WithCanonicalRedirects] to redirect the original paths. Index file names are still recognized by [WithIndexNames].
+func StripExtensions(extensions ...string) PathTranslator {
+	if len(extensions) == 0 {
+		panic("empty extension list")
+	}
+	for _, extension := range extensions {
+		if !strings.HasPrefix(extension, ".") || len(extension) < 2 {
+			panic(fmt.Sprintf("invalid file extension %q", extension))
+		}
+	}
+	return func(real string) (string, bool, error) {
+		external := absolute(real)
+		extension := path.Ext(external)
+		for _, stripped := range extensions {
+			if !strings.EqualFold(extension, stripped) {
+				continue
+			}
+			if strings.HasSuffix(external, "/"+extension) {
+				break // dot file without a name
+			}
+			return strings.TrimSuffix(external, extension), true, nil
+		}
+		return external, true, nil
+	}
+}
+
+// StripHTMLExtension publishes "about.html" as "/about".
+func StripHTMLExtension() PathTranslator {
+	return StripExtensions(".html", ".htm")
+}
+
+// Lowercase publishes every file under a lowercase path.
+func Lowercase() PathTranslator {
+	return func(real string) (string, bool, error) {
+		return strings.ToLower(absolute(real)), true, nil
+	}
+}
+
+// AddPrefix publishes every file under the directory, like "/static/app.js" for "app.js".
+func AddPrefix(directory string) PathTranslator {
+	directory = strings.Trim(directory, "/")
+	if directory == "" {
+		panic("cannot use an empty prefix directory")
+	}
+	return func(real string) (string, bool, error) {
+		return "/" + directory + absolute(real), true, nil
+	}
+}
+
+// StripDirectory publishes the files of the directory at the root, like "/app.js" for "public/app.js". Files outside of the directory are rejected.
+func StripDirectory(directory string) PathTranslator {
+	directory = "/" + strings.Trim(directory, "/") + "/"
+	if directory == "//" {
+		panic("cannot use an empty directory")
+	}
+	return func(real string) (string, bool, error) {
+		external := absolute(real)
+		if !strings.HasPrefix(external, directory) {
+			return "", false, nil
+		}
+		return external[len(directory)-1:], true, nil
+	}
+}
+
+// Rename publishes the files under the mapped paths. Paths missing from the map pass through.
+func Rename(paths map[string]string) PathTranslator {
+	renamed := make(map[string]string, len(paths))
+	for from, to := range paths {
+		if from == "" || to == "" {
+			panic(fmt.Sprintf("cannot rename %q to %q", from, to))
+		}
+		renamed[absolute(from)] = absolute(to)
+	}
+	return func(real string) (string, bool, error) {
+		external := absolute(real)
+		if to, ok := renamed[external]; ok {
+			return to, true, nil
+		}
+		return external, true, nil
+	}
+}
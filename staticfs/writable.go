@@ -0,0 +1,493 @@
+package staticfs
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/dkotik/oakmux"
+)
+
+const (
+	writableLayerName = "writable"
+
+	// writableTemporaryPrefix marks files that only exist while a write is in progress. They are never indexed.
+	writableTemporaryPrefix = ".staticfs-"
+)
+
+// WriteError is returned when a write request cannot be applied to the writable directory.
+type WriteError struct {
+	statusCode int
+	message    string
+}
+
+func (e *WriteError) Error() string {
+	return e.message
+}
+
+func (e *WriteError) HyperTextStatusCode() int {
+	return e.statusCode
+}
+
+var (
+	ErrForbiddenPath    = &WriteError{statusCode: http.StatusForbidden, message: "path is not writable"}
+	ErrMissingParent    = &WriteError{statusCode: http.StatusConflict, message: "parent collection does not exist"}
+	ErrCollectionExists = &WriteError{statusCode: http.StatusMethodNotAllowed, message: "collection already exists"}
+	ErrNotCollection    = &WriteError{statusCode: http.StatusConflict, message: "path is a collection"}
+	ErrInfiniteDepth    = &WriteError{statusCode: http.StatusForbidden, message: "infinite depth is not supported"}
+	ErrMKCOLBody        = &WriteError{statusCode: http.StatusUnsupportedMediaType, message: "collection request body is not supported"}
+	ErrPathConflict     = &WriteError{statusCode: http.StatusConflict, message: "request path is already taken by another file"}
+)
+
+// WithWritableDirectory serves the directory as the top layer and accepts PUT, DELETE, MKCOL, and PROPFIND requests that modify or list it, which is enough for tools that synchronize files over a WebDAV subset. Write requests address real paths, which must pass the [WithInclude] and [WithExclude] filters. With path translators, a new file is rejected when it would be published under the request path of another file. Uploads are limited by the request read limit of the mux and by [WithMaximumFileSizeOf]. After every change, only the changed path is scanned again and the rest of the index is carried over.
+func WithWritableDirectory(root string) Option {
+	return func(o *options) error {
+		if o.WritableRoot != "" {
+			return fmt.Errorf("writable directory is already set to %q", o.WritableRoot)
+		}
+		root, err := filepath.Abs(root)
+		if err != nil {
+			return fmt.Errorf("cannot resolve writable directory: %w", err)
+		}
+		if root, err = filepath.EvalSymlinks(root); err != nil {
+			return fmt.Errorf("cannot resolve writable directory: %w", err)
+		}
+		info, err := os.Stat(root)
+		if err != nil {
+			return fmt.Errorf("cannot use writable directory: %w", err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("writable path %q is not a directory", root)
+		}
+		o.WritableRoot = root
+		return WithLayer(writableLayerName, os.DirFS(root))(o)
+	}
+}
+
+// serveWrite handles the write methods and reports false for the others.
+func (fs *FS) serveWrite(
+	w http.ResponseWriter,
+	r *http.Request,
+	requested string,
+	mount string,
+) (ok bool, err error) {
+	switch r.Method {
+	case http.MethodPut:
+		return true, fs.put(w, r, requested)
+	case http.MethodDelete:
+		return true, fs.delete(w, requested)
+	case "MKCOL":
+		return true, fs.makeCollection(w, r, requested)
+	case "PROPFIND":
+		return true, fs.propfind(w, r, requested, mount)
+	case http.MethodOptions:
+		header := w.Header()
+		header.Set("DAV", "1")
+		header.Set("Allow", "OPTIONS, GET, HEAD, PUT, DELETE, MKCOL, PROPFIND")
+		w.WriteHeader(http.StatusNoContent)
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// writablePath maps the request path to a location inside the writable directory. It rejects paths that escape the directory, directly or through symbolic links, hidden paths, unless [WithHiddenFiles] is set, and paths left out of the index by the include and exclude patterns. The target is matched as a collection when it is one already or when the collection flag is set.
+func (fs *FS) writablePath(requested string, collection bool) (string, error) {
+	relative := strings.TrimPrefix(path.Clean("/"+requested), "/")
+	if relative == "" {
+		return fs.options.WritableRoot, nil
+	}
+	if !iofs.ValidPath(relative) {
+		return "", ErrForbiddenPath
+	}
+	segments := strings.Split(relative, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, writableTemporaryPrefix) {
+			return "", ErrForbiddenPath
+		}
+		if !fs.options.Hidden && strings.HasPrefix(segment, ".") {
+			return "", ErrForbiddenPath
+		}
+		if i < len(segments)-1 && fs.options.match(strings.Join(segments[:i+1], "/"), true) != "" {
+			return "", ErrForbiddenPath
+		}
+	}
+	full := filepath.Join(fs.options.WritableRoot, filepath.FromSlash(relative))
+	parent, err := filepath.EvalSymlinks(filepath.Dir(full))
+	if err != nil {
+		if errors.Is(err, iofs.ErrNotExist) {
+			return "", ErrMissingParent
+		}
+		return "", err
+	}
+	if parent != fs.options.WritableRoot && !strings.HasPrefix(parent, fs.options.WritableRoot+string(filepath.Separator)) {
+		return "", ErrForbiddenPath
+	}
+	info, err := os.Lstat(full)
+	if err == nil {
+		if info.Mode()&os.ModeSymlink != 0 {
+			return "", ErrForbiddenPath
+		}
+		collection = collection || info.IsDir()
+	}
+	if fs.options.match(relative, collection) != "" {
+		return "", ErrForbiddenPath
+	}
+	return filepath.Join(parent, filepath.Base(full)), nil
+}
+
+// writableReal returns the real path of the location returned by [FS.writablePath] within the writable layer.
+func (fs *FS) writableReal(full string) string {
+	relative, err := filepath.Rel(fs.options.WritableRoot, full)
+	if err != nil {
+		return "." // cannot happen for a location inside the directory, rescan all of it
+	}
+	return filepath.ToSlash(relative)
+}
+
+// checkPublishable maps the real path of a new file through the translators and rejects it, if the file would not be published or would take the request path of another file of the writable directory, which would fail the reload.
+func (fs *FS) checkPublishable(real string) error {
+	external, accept, err := fs.options.translate(real)
+	if err != nil {
+		return err
+	}
+	if !accept {
+		return ErrForbiddenPath
+	}
+	s := fs.current.Load()
+	if fingerprinted, ok := s.manifest[external]; ok {
+		external = fingerprinted
+	}
+	if f, ok := s.index[external]; ok && f.layer.name == writableLayerName && f.path != real {
+		return ErrPathConflict
+	}
+	return nil
+}
+
+// commit updates the index after a change to the real path of the writable directory and reverts the change, if the update fails, so that the directory never stays in a state that cannot be indexed.
+func (fs *FS) commit(real string, revert func() error) error {
+	err := fs.update(real)
+	if err == nil {
+		return nil
+	}
+	if revertErr := revert(); revertErr != nil {
+		return errors.Join(err, fmt.Errorf("cannot revert the change: %w", revertErr))
+	}
+	return err
+}
+
+// update rescans the real path of the writable directory, which may be a file or a collection, into a copy of the current snapshot. Files outside of the path, other than the originals of a precompressed variant, are carried over without reading them again.
+func (fs *FS) update(real string) error {
+	fs.reloadMu.Lock()
+	defer fs.reloadMu.Unlock()
+	current := fs.current.Load()
+	o := fs.options
+	layerIndex := -1
+	for i, l := range o.Layers {
+		if l.name == writableLayerName {
+			layerIndex = i
+			break
+		}
+	}
+	if layerIndex < 0 {
+		return errors.New("writable directory is not set")
+	}
+	l := o.Layers[layerIndex]
+	changed := func(candidate string) bool {
+		return real == "." || candidate == real || strings.HasPrefix(candidate, real+"/")
+	}
+
+	scan := &scanned{layers: make([]map[string]string, len(o.Layers))}
+	copy(scan.layers, current.scan.layers) // other layers did not change
+	published := make(map[string]string, len(current.scan.layers[layerIndex]))
+	for external, candidate := range current.scan.layers[layerIndex] {
+		if !changed(candidate) {
+			published[external] = candidate
+		}
+	}
+	scan.layers[layerIndex] = published
+	for _, exclusion := range current.scan.exclusions {
+		if exclusion.Layer != l.name || !changed(exclusion.Path) {
+			scan.exclusions = append(scan.exclusions, exclusion)
+		}
+	}
+	if _, err := iofs.Stat(l.fileSystem, real); err == nil {
+		if err = o.walk(scan, layerIndex, real); err != nil {
+			return fmt.Errorf("cannot update static file system: %w", err)
+		}
+	} else if !errors.Is(err, iofs.ErrNotExist) {
+		return fmt.Errorf("cannot update static file system: %w", err)
+	}
+	if err := o.merge(scan); err != nil {
+		return fmt.Errorf("cannot update static file system: %w", err)
+	}
+
+	reusable := make(map[source]*file, len(current.index))
+	for _, f := range current.index {
+		if f.layer == l && (changed(f.path) || changedVariant(f.path, changed)) {
+			continue // hash again
+		}
+		reusable[source{real: f.path, layer: f.layer}] = f
+	}
+	s, err := o.assemble(scan, reusable)
+	if err != nil {
+		return fmt.Errorf("cannot update static file system: %w", err)
+	}
+	close(fs.current.Swap(s).replaced)
+	return nil
+}
+
+// changedVariant reports whether any precompressed variant of the real path changed.
+func changedVariant(real string, changed func(string) bool) bool {
+	for _, precompressed := range precompressedExtensions {
+		if changed(real + precompressed.extension) {
+			return true
+		}
+	}
+	return false
+}
+
+// put atomically replaces the file with the request body by renaming a completely written temporary file.
+func (fs *FS) put(w http.ResponseWriter, r *http.Request, requested string) (err error) {
+	if strings.HasSuffix(requested, "/") {
+		return ErrNotCollection
+	}
+	full, err := fs.writablePath(requested, false)
+	if err != nil {
+		return err
+	}
+	if full == fs.options.WritableRoot {
+		return ErrForbiddenPath
+	}
+	fs.writeMu.Lock()
+	defer fs.writeMu.Unlock()
+	statusCode := http.StatusCreated
+	if info, err := os.Stat(full); err == nil {
+		if info.IsDir() {
+			return ErrNotCollection
+		}
+		statusCode = http.StatusNoContent
+	} else if err = fs.checkPublishable(strings.TrimPrefix(path.Clean("/"+requested), "/")); err != nil {
+		return err
+	}
+
+	body := io.Reader(r.Body)
+	if limit := fs.options.MaxFileSize; limit > 0 {
+		body = http.MaxBytesReader(w, r.Body, limit)
+	}
+	temporary, err := os.CreateTemp(filepath.Dir(full), writableTemporaryPrefix+"upload-*")
+	if err != nil {
+		return fmt.Errorf("cannot create temporary file: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = temporary.Close()
+			_ = os.Remove(temporary.Name())
+		}
+	}()
+	if _, err = io.Copy(temporary, body); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return oakmux.NewRequestTooLargeError(tooLarge.Limit)
+		}
+		return fmt.Errorf("cannot write uploaded file: %w", err)
+	}
+	if err = temporary.Sync(); err != nil {
+		return fmt.Errorf("cannot write uploaded file: %w", err)
+	}
+	if err = temporary.Close(); err != nil {
+		return fmt.Errorf("cannot write uploaded file: %w", err)
+	}
+	if err = os.Chmod(temporary.Name(), 0o644); err != nil {
+		return fmt.Errorf("cannot write uploaded file: %w", err)
+	}
+	revert := func() error { return os.Remove(full) }
+	if statusCode == http.StatusNoContent {
+		previous := temporary.Name() + "-previous"
+		if err = os.Link(full, previous); err != nil {
+			return fmt.Errorf("cannot keep the previous version: %w", err)
+		}
+		defer os.Remove(previous)
+		revert = func() error { return os.Rename(previous, full) }
+	}
+	if err = os.Rename(temporary.Name(), full); err != nil {
+		return fmt.Errorf("cannot replace file: %w", err)
+	}
+	if err = fs.commit(fs.writableReal(full), revert); err != nil {
+		return err
+	}
+	w.WriteHeader(statusCode)
+	return nil
+}
+
+// delete moves the file or collection aside before reloading the index, so that it can be restored, if the index depends on it.
+func (fs *FS) delete(w http.ResponseWriter, requested string) error {
+	full, err := fs.writablePath(requested, false)
+	if err != nil {
+		if errors.Is(err, ErrMissingParent) {
+			return ErrNotFound
+		}
+		return err
+	}
+	if full == fs.options.WritableRoot {
+		return ErrForbiddenPath
+	}
+	fs.writeMu.Lock()
+	defer fs.writeMu.Unlock()
+	if _, err = os.Lstat(full); err != nil {
+		if errors.Is(err, iofs.ErrNotExist) {
+			return ErrNotFound
+		}
+		return err
+	}
+	trash, err := os.MkdirTemp(filepath.Dir(full), writableTemporaryPrefix+"delete-*")
+	if err != nil {
+		return fmt.Errorf("cannot delete %q: %w", requested, err)
+	}
+	defer os.RemoveAll(trash)
+	deleted := filepath.Join(trash, filepath.Base(full))
+	if err = os.Rename(full, deleted); err != nil {
+		return fmt.Errorf("cannot delete %q: %w", requested, err)
+	}
+	if err = fs.commit(fs.writableReal(full), func() error { return os.Rename(deleted, full) }); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (fs *FS) makeCollection(w http.ResponseWriter, r *http.Request, requested string) error {
+	if r.ContentLength > 0 {
+		return ErrMKCOLBody
+	}
+	full, err := fs.writablePath(strings.TrimSuffix(requested, "/"), true)
+	if err != nil {
+		return err
+	}
+	fs.writeMu.Lock()
+	defer fs.writeMu.Unlock()
+	if err = os.Mkdir(full, 0o755); err != nil {
+		if errors.Is(err, iofs.ErrExist) {
+			return ErrCollectionExists
+		}
+		return fmt.Errorf("cannot create collection %q: %w", requested, err)
+	}
+	if err = fs.commit(fs.writableReal(full), func() error { return os.Remove(full) }); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusCreated)
+	return nil
+}
+
+type multiStatus struct {
+	XMLName   xml.Name      `xml:"D:multistatus"`
+	Namespace string        `xml:"xmlns:D,attr"`
+	Responses []davResponse `xml:"D:response"`
+}
+
+type davResponse struct {
+	Href     string      `xml:"D:href"`
+	Property davProperty `xml:"D:propstat>D:prop"`
+	Status   string      `xml:"D:propstat>D:status"`
+}
+
+type davProperty struct {
+	DisplayName   string       `xml:"D:displayname"`
+	ResourceType  *davResource `xml:"D:resourcetype"`
+	ContentLength int64        `xml:"D:getcontentlength,omitempty"`
+	LastModified  string       `xml:"D:getlastmodified"`
+	ETag          string       `xml:"D:getetag,omitempty"`
+}
+
+type davResource struct {
+	Collection *struct{} `xml:"D:collection"`
+}
+
+// propfind lists the properties of the resource and, with depth 1, of its children. Property selection in the request body is ignored and all supported properties are returned.
+func (fs *FS) propfind(w http.ResponseWriter, r *http.Request, requested, mount string) error {
+	depth := r.Header.Get("Depth")
+	switch depth {
+	case "0", "1":
+	case "", "infinity":
+		return ErrInfiniteDepth
+	default:
+		return &WriteError{statusCode: http.StatusBadRequest, message: "invalid depth: " + depth}
+	}
+	full, err := fs.writablePath(requested, false)
+	if err != nil {
+		if errors.Is(err, ErrMissingParent) {
+			return ErrNotFound
+		}
+		return err
+	}
+	info, err := os.Stat(full)
+	if err != nil {
+		if errors.Is(err, iofs.ErrNotExist) {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	relative := strings.Trim(path.Clean("/"+requested), "/")
+	result := multiStatus{Namespace: "DAV:"}
+	result.Responses = append(result.Responses, fs.davResponse(mount, relative, info))
+	if depth == "1" && info.IsDir() {
+		entries, err := os.ReadDir(full)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if strings.HasPrefix(name, writableTemporaryPrefix) ||
+				!fs.options.Hidden && strings.HasPrefix(name, ".") ||
+				fs.options.match(path.Join(relative, name), entry.IsDir()) != "" {
+				continue
+			}
+			child, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			result.Responses = append(result.Responses, fs.davResponse(mount, path.Join(relative, entry.Name()), child))
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	if _, err = io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	return xml.NewEncoder(w).Encode(result)
+}
+
+func (fs *FS) davResponse(mount, relative string, info iofs.FileInfo) davResponse {
+	href := mount + (&url.URL{Path: "/" + relative}).EscapedPath()
+	property := davProperty{
+		DisplayName:  info.Name(),
+		LastModified: info.ModTime().UTC().Format(http.TimeFormat),
+	}
+	if info.IsDir() {
+		if !strings.HasSuffix(href, "/") {
+			href += "/"
+		}
+		property.ResourceType = &davResource{Collection: &struct{}{}}
+	} else {
+		property.ResourceType = &davResource{}
+		property.ContentLength = info.Size()
+		if f, ok := fs.current.Load().index["/"+relative]; ok && f.layer.name == writableLayerName {
+			property.ETag = f.etag
+		}
+	}
+	return davResponse{
+		Href:     href,
+		Property: property,
+		Status:   "HTTP/1.1 200 OK",
+	}
+}
@@ -0,0 +1,292 @@
+package oakmux
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const RequestTimeoutHeader = "Request-Timeout"
+
+// TimeoutError is returned when a request deadline expires. Its status code is [http.StatusServiceUnavailable], if the handler was abandoned by the [TimeoutLimiter], or [http.StatusGatewayTimeout], if the domain call itself reported [context.DeadlineExceeded].
+type TimeoutError struct {
+	timeout   time.Duration
+	abandoned bool
+}
+
+func (e *TimeoutError) Error() string {
+	return http.StatusText(e.HyperTextStatusCode())
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+func (e *TimeoutError) HyperTextStatusCode() int {
+	if e.abandoned {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusGatewayTimeout
+}
+
+func (e *TimeoutError) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("message", "request timed out"),
+		slog.Duration("timeout", e.timeout),
+		slog.Bool("abandoned", e.abandoned),
+	)
+}
+
+// TimeoutLimiter sets a deadline on the request context passed down to the domain calls. The next [Handler] writes into a buffer, which is copied to the [http.ResponseWriter] only if the handler completes in time, so that a late handler never races the error response. A handler that flushes the response or a route that uses [SkipTimeoutBuffering] streams instead: the buffered part is sent right away and the rest is written through, so a timeout can only cut the response short.
+type TimeoutLimiter struct {
+	timeout       time.Duration
+	clientMaximum time.Duration
+	next          Handler
+}
+
+func NewTimeoutLimiter(next Handler, timeout time.Duration) *TimeoutLimiter {
+	if next == nil {
+		panic("cannot use a <nil> HTTP handler")
+	}
+	if timeout <= 0 {
+		panic("timeout must be greater than 0")
+	}
+	return &TimeoutLimiter{
+		timeout: timeout,
+		next:    next,
+	}
+}
+
+// NewClientTimeoutLimiter creates a [TimeoutLimiter] that honours the [RequestTimeoutHeader] in seconds, capped by the maximum. Requests without a valid header use the timeout.
+func NewClientTimeoutLimiter(next Handler, timeout, maximum time.Duration) *TimeoutLimiter {
+	if maximum < timeout {
+		panic("maximum client timeout cannot be less than the default timeout")
+	}
+	l := NewTimeoutLimiter(next, timeout)
+	l.clientMaximum = maximum
+	return l
+}
+
+func NewTimeoutMiddleware(timeout time.Duration) Middleware {
+	return func(next Handler) Handler {
+		return NewTimeoutLimiter(next, timeout)
+	}
+}
+
+func NewClientTimeoutMiddleware(timeout, maximum time.Duration) Middleware {
+	return func(next Handler) Handler {
+		return NewClientTimeoutLimiter(next, timeout, maximum)
+	}
+}
+
+func (l *TimeoutLimiter) requestTimeout(r *http.Request) time.Duration {
+	if l.clientMaximum == 0 {
+		return l.timeout
+	}
+	value := r.Header.Get(RequestTimeoutHeader)
+	if value == "" {
+		return l.timeout
+	}
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil || seconds <= 0 {
+		return l.timeout
+	}
+	requested := time.Duration(seconds * float64(time.Second))
+	if requested > l.clientMaximum {
+		return l.clientMaximum
+	}
+	return requested
+}
+
+func (l *TimeoutLimiter) ServeHyperText(
+	w http.ResponseWriter,
+	r *http.Request,
+) error {
+	timeout := l.requestTimeout(r)
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	buffer := &timeoutWriter{header: make(http.Header), underlying: w}
+	done := make(chan error, 1)
+	panicked := make(chan any, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				panicked <- p
+			}
+		}()
+		done <- l.next.ServeHyperText(buffer, r.WithContext(ctx))
+	}()
+
+	select {
+	case p := <-panicked:
+		panic(p)
+	case err := <-done:
+		buffer.mu.Lock()
+		defer buffer.mu.Unlock()
+		if buffer.committed {
+			return timeoutError(err, timeout)
+		}
+		header := w.Header()
+		for key, values := range buffer.header {
+			header[key] = values
+		}
+		if err != nil {
+			return timeoutError(err, timeout)
+		}
+		if buffer.statusCode == 0 {
+			buffer.statusCode = http.StatusOK
+		}
+		w.WriteHeader(buffer.statusCode)
+		_, err = w.Write(buffer.body.Bytes())
+		return err
+	case <-ctx.Done():
+		buffer.mu.Lock()
+		defer buffer.mu.Unlock()
+		buffer.abandoned = true
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return &TimeoutError{timeout: timeout, abandoned: true}
+		}
+		return ctx.Err()
+	}
+}
+
+// timeoutError reports a deadline error of the domain call as [TimeoutError]. Errors of nested limiters are returned unchanged, so that the innermost limiter decides the status code.
+func timeoutError(err error, timeout time.Duration) error {
+	var nested *TimeoutError
+	if errors.As(err, &nested) {
+		return err
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &TimeoutError{timeout: timeout}
+	}
+	return err
+}
+
+// SkipTimeoutBuffering is a [Middleware] that streams the response of a route through the [TimeoutLimiter] instead of buffering it, which suits large files and event streams. The deadline still applies to the request context.
+func SkipTimeoutBuffering(next Handler) Handler {
+	return HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		for current := w; current != nil; {
+			if tw, ok := current.(*timeoutWriter); ok {
+				if err := tw.stream(); err != nil {
+					return err
+				}
+				break
+			}
+			unwrapper, ok := current.(interface{ Unwrap() http.ResponseWriter })
+			if !ok {
+				break
+			}
+			current = unwrapper.Unwrap()
+		}
+		return next.ServeHyperText(w, r)
+	})
+}
+
+type timeoutWriter struct {
+	mu         sync.Mutex
+	header     http.Header
+	body       bytes.Buffer
+	statusCode int
+	abandoned  bool
+	streaming  bool
+	committed  bool // header was sent to the underlying writer
+	underlying http.ResponseWriter
+}
+
+// Header returns the private header map of the writer. It is copied to the underlying writer, when the response is sent, so the handler never touches the map the limiter uses for the error response. An abandoned handler gets a throwaway map.
+func (w *timeoutWriter) Header() http.Header {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.abandoned {
+		return make(http.Header)
+	}
+	return w.header
+}
+
+func (w *timeoutWriter) WriteHeader(statusCode int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.abandoned || w.statusCode != 0 {
+		return
+	}
+	w.statusCode = statusCode
+	if w.streaming {
+		w.commitLocked()
+	}
+}
+
+func (w *timeoutWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.abandoned {
+		return 0, http.ErrHandlerTimeout
+	}
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	if w.streaming {
+		if !w.committed {
+			w.commitLocked()
+		}
+		return w.underlying.Write(b)
+	}
+	return w.body.Write(b)
+}
+
+// Flush switches the writer to streaming and flushes the underlying writer.
+func (w *timeoutWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.streamLocked(); err != nil {
+		return
+	}
+	if !w.committed {
+		w.statusCode = http.StatusOK
+		w.commitLocked()
+	}
+	_ = http.NewResponseController(w.underlying).Flush()
+}
+
+func (w *timeoutWriter) Unwrap() http.ResponseWriter {
+	return w.underlying
+}
+
+// stream sends the buffered response to the underlying writer and writes everything after it through. The limiter can no longer replace the response with an error.
+func (w *timeoutWriter) stream() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.streamLocked()
+}
+
+func (w *timeoutWriter) streamLocked() error {
+	if w.abandoned {
+		return http.ErrHandlerTimeout
+	}
+	if w.streaming {
+		return nil
+	}
+	w.streaming = true
+	if w.statusCode == 0 {
+		return nil // nothing was written yet
+	}
+	w.commitLocked()
+	_, err := w.underlying.Write(w.body.Bytes())
+	w.body.Reset()
+	return err
+}
+
+// commitLocked copies the header to the underlying writer and sends the status code.
+func (w *timeoutWriter) commitLocked() {
+	header := w.underlying.Header()
+	for key, values := range w.header {
+		header[key] = append([]string(nil), values...)
+	}
+	w.underlying.WriteHeader(w.statusCode)
+	w.committed = true
+}
@@ -0,0 +1,161 @@
+package oakmux
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTimeoutLimiter(t *testing.T) {
+	slow := HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		if _, ok := r.Context().Deadline(); !ok {
+			t.Error("request context has no deadline")
+			return nil
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), time.Millisecond)
+		defer cancel()
+		<-ctx.Done() // upstream call timed out
+		io.WriteString(w, "partial write")
+		return ctx.Err()
+	})
+	mux, err := New(
+		WithTimeout(time.Second*5),
+		WithRouteHandler("slow", "/slow", slow, NewTimeoutMiddleware(time.Second)),
+		WithRouteHandler("fast", "/fast", newTestHandler(t)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectFromRequest(mux, httptest.NewRequest(http.MethodGet, "/fast", nil), http.StatusOK, "/fast")(t)
+	expectFromRequest(mux, httptest.NewRequest(http.MethodGet, "/slow", nil), http.StatusGatewayTimeout, "")(t)
+}
+
+func TestTimeoutLimiterAbandonsHandler(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	limiter := NewTimeoutLimiter(HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		<-release // ignores context
+		return nil
+	}), time.Millisecond*10)
+	expectFromRequest(limiter, httptest.NewRequest(http.MethodGet, "/", nil), http.StatusServiceUnavailable, "")(t)
+}
+
+func TestClientTimeoutHeader(t *testing.T) {
+	limiter := NewClientTimeoutLimiter(HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		deadline, ok := r.Context().Deadline()
+		if !ok {
+			t.Error("request context has no deadline")
+			return nil
+		}
+		if remaining := time.Until(deadline); remaining > time.Second*2 {
+			t.Errorf("client timeout was not capped: %s", remaining)
+		}
+		return nil
+	}), time.Millisecond*500, time.Second*2)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(RequestTimeoutHeader, "60")
+	if err := limiter.ServeHyperText(httptest.NewRecorder(), r); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTimeoutLimiterStreaming(t *testing.T) {
+	flushed := make(chan struct{})
+	release := make(chan struct{})
+	streaming := HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		w.WriteHeader(http.StatusAccepted)
+		io.WriteString(w, "first")
+		err := http.NewResponseController(w).Flush()
+		close(flushed)
+		if err != nil {
+			t.Error(err)
+			return nil
+		}
+		<-release
+		_, err = io.WriteString(w, " second")
+		return err
+	})
+	w := httptest.NewRecorder()
+	done := make(chan error, 1)
+	go func() {
+		done <- NewTimeoutLimiter(streaming, time.Second*5).ServeHyperText(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	}()
+	<-flushed
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusAccepted || w.Body.String() != "first second" || !w.Flushed {
+		t.Fatalf("unexpected streamed response: %d %q flushed=%t", w.Code, w.Body.String(), w.Flushed)
+	}
+
+	recorder := httptest.NewRecorder()
+	mux, err := New(
+		WithTimeout(time.Second*5),
+		WithRouteHandler("unbuffered", "/unbuffered", HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+			if _, err := io.WriteString(w, "unbuffered"); err != nil {
+				return err
+			}
+			if recorder.Body.String() != "unbuffered" {
+				t.Error("response was buffered by the timeout limiter")
+			}
+			return nil
+		}), SkipTimeoutBuffering),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = mux.ServeHyperText(recorder, httptest.NewRequest(http.MethodGet, "/unbuffered", nil)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTimeoutLimiterAbandonedStreamHeaders(t *testing.T) {
+	stop := make(chan struct{})
+	finished := make(chan struct{})
+	limiter := NewTimeoutLimiter(SkipTimeoutBuffering(HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		defer close(finished)
+		io.WriteString(w, "streaming")
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return nil
+			default:
+				w.Header().Set("X-Progress", strconv.Itoa(i)) // ignores the deadline
+			}
+		}
+	})), time.Millisecond*20)
+
+	w := httptest.NewRecorder()
+	err := limiter.ServeHyperText(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	var timeout *TimeoutError
+	if !errors.As(err, &timeout) {
+		t.Fatalf("expected a timeout error, got: %v", err)
+	}
+	for i := 0; i < 1000; i++ {
+		w.Header().Set("Content-Type", "text/plain") // error handler
+	}
+	close(stop)
+	<-finished
+}
+
+func TestNestedTimeoutLimiters(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	inner := NewTimeoutLimiter(HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		<-release // ignores context
+		return nil
+	}), time.Millisecond*20)
+	expectFromRequest(
+		NewTimeoutLimiter(inner, time.Second*5),
+		httptest.NewRequest(http.MethodGet, "/", nil),
+		http.StatusServiceUnavailable, "",
+	)(t)
+}